@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// apiDispatcher limits how many GitHub API calls run at once and how soon
+// after each other they start, independent of how much local work (cloning,
+// comparing, copying) runs in parallel.
+type apiDispatcher struct {
+	slots    chan struct{}
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newApiDispatcher(concurrency int, interval time.Duration) *apiDispatcher {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &apiDispatcher{
+		slots:    make(chan struct{}, concurrency),
+		interval: interval,
+	}
+}
+
+// acquire blocks until an API call may start, returning early with the error
+// of runCtx if the run is cancelled meanwhile. Every successful acquire must
+// be followed by a release once the call is done.
+func (d *apiDispatcher) acquire() error {
+	select {
+	case d.slots <- struct{}{}:
+	case <-runCtx.Done():
+		return runCtx.Err()
+	}
+
+	d.mu.Lock()
+	now := time.Now()
+	start := d.next
+	if start.Before(now) {
+		start = now
+	}
+	d.next = start.Add(d.interval)
+	d.mu.Unlock()
+
+	err := sleepCtx(time.Until(start))
+	if err != nil {
+		d.release()
+	}
+	return err
+}
+
+func (d *apiDispatcher) release() {
+	<-d.slots
+}
+
+// Dispatcher every gh invocation goes through. API calls are serialized
+// unless api_concurrency is configured.
+var ghDispatcher = newApiDispatcher(1, 0)
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestApiDispatcherConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		want        int32
+	}{
+		{name: "serialized", concurrency: 1, want: 1},
+		{name: "parallel", concurrency: 3, want: 3},
+		{name: "defaults to serialized", concurrency: 0, want: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := newApiDispatcher(test.concurrency, 0)
+
+			var active, max_active atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := d.acquire(); err != nil {
+						t.Error(err)
+						return
+					}
+					defer d.release()
+
+					n := active.Add(1)
+					for {
+						seen := max_active.Load()
+						if n <= seen || max_active.CompareAndSwap(seen, n) {
+							break
+						}
+					}
+					time.Sleep(20 * time.Millisecond)
+					active.Add(-1)
+				}()
+			}
+			wg.Wait()
+
+			if got := max_active.Load(); got != test.want {
+				t.Errorf("%d calls ran at once, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApiDispatcherInterval(t *testing.T) {
+	interval := 30 * time.Millisecond
+	d := newApiDispatcher(4, interval)
+
+	var mu sync.Mutex
+	var starts []time.Time
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.acquire(); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			starts = append(starts, time.Now())
+			mu.Unlock()
+			d.release()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	for i := 1; i < len(starts); i++ {
+		// Allow for timer granularity
+		if gap := starts[i].Sub(starts[i-1]); gap < interval-5*time.Millisecond {
+			t.Errorf("call %d started %s after the previous one, want at least %s", i, gap, interval)
+		}
+	}
+}
+
+func TestApiDispatcherCancelled(t *testing.T) {
+	defer func(ctx context.Context) { runCtx = ctx }(runCtx)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		// Whether the only slot is taken when acquiring
+		taken bool
+	}{
+		{name: "waiting for a slot", taken: true},
+		{name: "waiting for the interval", interval: time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			runCtx = ctx
+
+			d := newApiDispatcher(1, test.interval)
+			if err := d.acquire(); err != nil {
+				t.Fatal(err)
+			}
+			if !test.taken {
+				d.release()
+			}
+
+			done := make(chan error)
+			go func() { done <- d.acquire() }()
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+
+			select {
+			case err := <-done:
+				if err != context.Canceled {
+					t.Errorf("acquire() = %v, want context.Canceled", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("acquire() didn't return after the cancellation")
+			}
+
+			want_slots := 0
+			if test.taken {
+				want_slots = 1
+			}
+			if len(d.slots) != want_slots {
+				t.Errorf("%d slots taken after the cancelled acquire, want %d", len(d.slots), want_slots)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+// inactiveReason returns why repo_name can't receive sync PRs, archived or
+// disabled, or an empty string if it can. A variable so it can be replaced
+// along with prClient, e.g. by a local fake.
+var inactiveReason = func(repo_name string) (string, error) {
+	view, err := prClient.ViewRepo(repo_name)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case view.Archived:
+		return "archived", nil
+	case view.Disabled:
+		return "disabled", nil
+	}
+	return "", nil
+}
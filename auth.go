@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// checkGithubAuth fails when there is neither a token in GH_TOKEN or
+// GITHUB_TOKEN nor an authenticated gh, which pushing and creating PRs need.
+// Without this check the first push fails with a confusing auth error.
+func checkGithubAuth() error {
+	if os.Getenv("GH_TOKEN") != "" || os.Getenv("GITHUB_TOKEN") != "" {
+		return nil
+	}
+
+	_, err := runGh("auth", "status")
+	if err != nil {
+		logVerbose("gh auth status: %s", err)
+		return errors.New(
+			"a GitHub token is required for pushing and creating PRs, set GH_TOKEN or run gh auth login (or use -dry-run)",
+		)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import "fmt"
+
+// baseBranch returns the branch sync PRs for repo_name target. Without a
+// configured base branch the repo's default branch is used.
+func baseBranch(c *Config, repo_name string) (string, error) {
+	if base, ok := c.BaseBranches[repo_name]; ok {
+		return base, nil
+	}
+	if c.BaseBranch != "" {
+		return c.BaseBranch, nil
+	}
+	if base := c.Inventory[repo_name].DefaultBranch; base != "" {
+		return base, nil
+	}
+	return defaultBranch(repo_name)
+}
+
+// defaultBranch queries GitHub for the default branch of repo_name.
+func defaultBranch(repo_name string) (string, error) {
+	view, err := prClient.ViewRepo(repo_name)
+	if err != nil {
+		return "", err
+	}
+	if view.DefaultBranch == "" {
+		return "", fmt.Errorf("%s has no default branch", repo_name)
+	}
+	return view.DefaultBranch, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os"
+)
+
+// Markers delimiting the managed block of a file the repo also edits, e.g.
+// "# BEGIN ecsact_common". Only the lines from the begin marker through the
+// end marker are synced into existing repo files, whatever comment syntax
+// surrounds the markers.
+const (
+	blockBeginMarker = "BEGIN ecsact_common"
+	blockEndMarker   = "END ecsact_common"
+)
+
+// managedBlockBounds returns the byte range of the managed block in content,
+// from the start of the begin marker line to the end of the end marker line.
+func managedBlockBounds(content []byte) (int, int, bool) {
+	begin := bytes.Index(content, []byte(blockBeginMarker))
+	if begin < 0 {
+		return 0, 0, false
+	}
+	end := bytes.Index(content[begin:], []byte(blockEndMarker))
+	if end < 0 {
+		return 0, 0, false
+	}
+	end += begin
+
+	start := bytes.LastIndexByte(content[:begin], '\n') + 1
+	if newline := bytes.IndexByte(content[end:], '\n'); newline >= 0 {
+		end += newline + 1
+	} else {
+		end = len(content)
+	}
+	return start, end, true
+}
+
+// hasManagedBlock reports whether the managed file at source_path contains a
+// managed block.
+func hasManagedBlock(source_path string) (bool, error) {
+	content, err := os.ReadFile(source_path)
+	if err != nil {
+		return false, err
+	}
+	_, _, ok := managedBlockBounds(content)
+	return ok, nil
+}
+
+// mergeManagedBlock replaces the managed block of repo_content with the one of
+// source, keeping the repo's content around it. Repo files without markers
+// get the block appended.
+func mergeManagedBlock(source []byte, repo_content []byte) []byte {
+	src_start, src_end, ok := managedBlockBounds(source)
+	if !ok {
+		return source
+	}
+	block := source[src_start:src_end]
+
+	var merged []byte
+	if start, end, ok := managedBlockBounds(repo_content); ok {
+		merged = append(merged, repo_content[:start]...)
+		merged = append(merged, block...)
+		merged = append(merged, repo_content[end:]...)
+		return merged
+	}
+
+	merged = append(merged, repo_content...)
+	if len(merged) > 0 && merged[len(merged)-1] != '\n' {
+		merged = append(merged, '\n')
+	}
+	return append(merged, block...)
+}
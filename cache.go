@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// compareCache persists source file hashes and repo diff results across runs
+// so unchanged sources aren't rehashed and in sync repos aren't re-cloned.
+// All methods are safe to call on a nil *compareCache which caches nothing.
+type compareCache struct {
+	mu       sync.Mutex
+	filename string
+
+	// Keyed by source path and line endings
+	Hashes map[string]cachedHash `json:"hashes"`
+	// Keyed by repo name
+	Diffs map[string]cachedDiff `json:"diffs"`
+}
+
+type cachedHash struct {
+	ModTime int64  `json:"mod_time"`
+	Size    int64  `json:"size"`
+	Hash    string `json:"hash"`
+}
+
+// cachedDiff is the diff found the last time a repo was compared. It is only
+// valid while both the repo and the managed files are unchanged.
+type cachedDiff struct {
+	RepoHead     string   `json:"repo_head"`
+	SourceKey    string   `json:"source_key"`
+	NewFiles     []string `json:"new_files"`
+	ChangedFiles []string `json:"changed_files"`
+	DeletedFiles []string `json:"deleted_files"`
+}
+
+// Cache used when hashing managed files, loaded in main() when enabled.
+var hashCache *compareCache
+
+func loadCompareCache(filename string) (*compareCache, error) {
+	cache := &compareCache{
+		filename: filename,
+		Hashes:   map[string]cachedHash{},
+		Diffs:    map[string]cachedDiff{},
+	}
+
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, cache)
+	if err != nil {
+		// A corrupt cache is only a missed optimization
+		logWarn("ignoring unreadable cache %s: %s", filename, err)
+		cache.Hashes = map[string]cachedHash{}
+		cache.Diffs = map[string]cachedDiff{}
+	}
+	if cache.Hashes == nil {
+		cache.Hashes = map[string]cachedHash{}
+	}
+	if cache.Diffs == nil {
+		cache.Diffs = map[string]cachedDiff{}
+	}
+
+	return cache, nil
+}
+
+func (cache *compareCache) save() error {
+	if cache == nil {
+		return nil
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	content, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(cache.filename, content, 0644)
+}
+
+func hashCacheKey(m fileMapping) string {
+	return m.Source + "\x00" + m.Eol
+}
+
+// lookupHash returns the cached hash of m if its source hasn't changed since
+// it was cached.
+func (cache *compareCache) lookupHash(m fileMapping, stat os.FileInfo) (string, bool) {
+	if cache == nil {
+		return "", false
+	}
+
+	return cache.lookupKey(hashCacheKey(m), stat)
+}
+
+// lookupKey returns the hash cached under key if the file described by stat
+// hasn't changed since it was cached.
+func (cache *compareCache) lookupKey(key string, stat os.FileInfo) (string, bool) {
+	if cache == nil {
+		return "", false
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cached, ok := cache.Hashes[key]
+	if !ok || cached.ModTime != stat.ModTime().UnixNano() || cached.Size != stat.Size() {
+		return "", false
+	}
+	return cached.Hash, true
+}
+
+func (cache *compareCache) storeHash(m fileMapping, stat os.FileInfo, hash string) {
+	cache.storeKey(hashCacheKey(m), stat, hash)
+}
+
+func (cache *compareCache) storeKey(key string, stat os.FileInfo, hash string) {
+	if cache == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.Hashes[key] = cachedHash{
+		ModTime: stat.ModTime().UnixNano(),
+		Size:    stat.Size(),
+		Hash:    hash,
+	}
+}
+
+// sourceKey identifies the managed files synced to a repo, the source commit
+// and the attributes compared, so a cached diff is invalidated when any of
+// them change.
+func sourceKey(source_sha string, mappings []fileMapping, detect changeDetect) (string, error) {
+	lines := []string{source_sha, fmt.Sprintf("%+v", detect)}
+	for _, mapping := range mappings {
+		hash, err := mapping.hash()
+		if err != nil {
+			return "", err
+		}
+
+		stat, err := os.Stat(mapping.Source)
+		if err != nil {
+			return "", err
+		}
+
+		lines = append(lines, fmt.Sprintf(
+			"%s\x00%s\x00%s\x00%o", mapping.Dest, mapping.Eol, hash, fileMode(stat.Mode()),
+		))
+	}
+	sort.Strings(lines[2:])
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (cache *compareCache) lookupDiff(repo_name string, repo_head string, source_key string) (cachedDiff, bool) {
+	if cache == nil || repo_head == "" {
+		return cachedDiff{}, false
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cached, ok := cache.Diffs[repo_name]
+	if !ok || cached.RepoHead != repo_head || cached.SourceKey != source_key {
+		return cachedDiff{}, false
+	}
+	return cached, true
+}
+
+func (cache *compareCache) storeDiff(repo_name string, repo_head string, source_key string, files_diff *FilesDiff) {
+	if cache == nil || repo_head == "" {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.Diffs[repo_name] = cachedDiff{
+		RepoHead:     repo_head,
+		SourceKey:    source_key,
+		NewFiles:     files_diff.NewFiles,
+		ChangedFiles: files_diff.ChangedFiles,
+		DeletedFiles: files_diff.DeletedFiles,
+	}
+}
+
+// remoteHead returns the commit branch points to at url without cloning it.
+func remoteHead(url string, branch string) (string, error) {
+	output, err := runGit(".", "ls-remote", url, "refs/heads/"+branch)
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareCacheHash(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "README.md")
+	writeTestFile(t, source, "# common\n", 0644)
+	stat, err := os.Stat(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(dir, "cache.json")
+	cache, err := loadCompareCache(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping := fileMapping{Source: source, Dest: "README.md"}
+	cache.storeHash(mapping, stat, "abc")
+	err = cache.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err = loadCompareCache(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash, ok := cache.lookupHash(mapping, stat); !ok || hash != "abc" {
+		t.Errorf("lookupHash() after a reload = %q, %v, want a hit", hash, ok)
+	}
+	if _, ok := cache.lookupHash(fileMapping{Source: source, Eol: "crlf"}, stat); ok {
+		t.Error("lookupHash() hit for other line endings")
+	}
+
+	later := stat.ModTime().Add(time.Second)
+	if err := os.Chtimes(source, later, later); err != nil {
+		t.Fatal(err)
+	}
+	touched, err := os.Stat(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.lookupHash(mapping, touched); ok {
+		t.Error("lookupHash() hit for a modified source")
+	}
+
+	writeTestFile(t, source, "# common, longer\n", 0644)
+	if err := os.Chtimes(source, stat.ModTime(), stat.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	resized, err := os.Stat(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.lookupHash(mapping, resized); ok {
+		t.Error("lookupHash() hit for a resized source")
+	}
+
+	var no_cache *compareCache
+	no_cache.storeHash(mapping, stat, "abc")
+	if _, ok := no_cache.lookupHash(mapping, stat); ok {
+		t.Error("lookupHash() of a nil cache hit")
+	}
+	if err := no_cache.save(); err != nil {
+		t.Errorf("save() of a nil cache failed: %v", err)
+	}
+}
+
+func TestCompareCacheDiff(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "README.md")
+	writeTestFile(t, source, "# common\n", 0644)
+	mappings := []fileMapping{{Source: source, Dest: "README.md"}}
+
+	detect, err := parseChangeDetect(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := sourceKey("sha1", mappings, detect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := loadCompareCache(filepath.Join(dir, "cache.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.storeDiff("ecsact_cli", "head1", key, &FilesDiff{ChangedFiles: []string{"README.md"}})
+
+	cached, ok := cache.lookupDiff("ecsact_cli", "head1", key)
+	if !ok || len(cached.ChangedFiles) != 1 {
+		t.Errorf("lookupDiff() = %+v, %v, want the stored diff", cached, ok)
+	}
+	if _, ok := cache.lookupDiff("ecsact_cli", "head2", key); ok {
+		t.Error("lookupDiff() hit after the repo changed")
+	}
+	if _, ok := cache.lookupDiff("ecsact_runtime", "head1", key); ok {
+		t.Error("lookupDiff() hit for another repo")
+	}
+
+	cache.storeDiff("ecsact_runtime", "", key, &FilesDiff{})
+	if _, ok := cache.lookupDiff("ecsact_runtime", "", key); ok {
+		t.Error("lookupDiff() hit without a repo head")
+	}
+
+	content_detect, err := parseChangeDetect([]string{"content"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		source_sha string
+		mappings   []fileMapping
+		detect     changeDetect
+		// Applied to the managed file before computing the key
+		modify func(t *testing.T)
+	}{
+		{name: "source commit", source_sha: "sha2", mappings: mappings, detect: detect},
+		{name: "destination", source_sha: "sha1", mappings: []fileMapping{{Source: source, Dest: "docs/README.md"}}, detect: detect},
+		{name: "line endings", source_sha: "sha1", mappings: []fileMapping{{Source: source, Dest: "README.md", Eol: "crlf"}}, detect: detect},
+		{name: "change detect", source_sha: "sha1", mappings: mappings, detect: content_detect},
+		{
+			name: "content", source_sha: "sha1", mappings: mappings, detect: detect,
+			modify: func(t *testing.T) { writeTestFile(t, source, "# changed\n", 0644) },
+		},
+		{
+			name: "mode", source_sha: "sha1", mappings: mappings, detect: detect,
+			modify: func(t *testing.T) {
+				if err := os.Chmod(source, 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writeTestFile(t, source, "# common\n", 0644)
+			if err := os.Chmod(source, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if test.modify != nil {
+				test.modify(t)
+			}
+
+			other_key, err := sourceKey(test.source_sha, test.mappings, test.detect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other_key == key {
+				t.Errorf("sourceKey() unchanged")
+			}
+			if _, ok := cache.lookupDiff("ecsact_cli", "head1", other_key); ok {
+				t.Errorf("lookupDiff() hit")
+			}
+		})
+	}
+}
+
+func TestLoadCompareCacheCorrupt(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cache.json")
+	writeTestFile(t, filename, "{not json", 0644)
+
+	var cache *compareCache
+	var err error
+	output := captureStdout(t, func() { cache, err = loadCompareCache(filename) })
+	if err != nil {
+		t.Fatalf("loadCompareCache() of a corrupt cache failed: %v", err)
+	}
+	if !strings.Contains(output, "ignoring unreadable cache") {
+		t.Errorf("loadCompareCache() logged %q, want a warning", output)
+	}
+	if len(cache.Hashes) != 0 || len(cache.Diffs) != 0 {
+		t.Errorf("loadCompareCache() of a corrupt cache = %+v, want an empty cache", cache)
+	}
+}
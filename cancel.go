@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Context of the whole run, cancelled on SIGINT or SIGTERM and when -timeout
+// passes. Every subprocess and network request is tied to it so a cancelled
+// run aborts in flight clones and pushes. Set in main().
+var runCtx = context.Background()
+
+// How long a killed subprocess may keep its output open, e.g. through its own
+// children, before it's abandoned.
+const cancelWaitDelay = time.Second
+
+// sleepCtx sleeps for d, returning early with the error of runCtx if the run
+// is cancelled meanwhile.
+func sleepCtx(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-runCtx.Done():
+		return runCtx.Err()
+	}
+}
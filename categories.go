@@ -0,0 +1,37 @@
+package main
+
+// ChangeCategory adds to the PR body and selects the reviewers of sync PRs
+// whose changes are dominated by files matching Paths.
+type ChangeCategory struct {
+	Name string `yaml:"name"`
+	// Globs matched against the destination paths of new and changed files
+	Paths []string `yaml:"paths"`
+	// Template appended to the pr_body, or the default body without one,
+	// rendered with the same data as pr_body
+	Body      string   `yaml:"body"`
+	Reviewers []string `yaml:"reviewers"`
+}
+
+// dominantCategory returns the category matching the most new and changed
+// files in files_diff, the first configured one winning ties, or nil when no
+// category matches any file.
+func dominantCategory(categories []ChangeCategory, files_diff *FilesDiff) *ChangeCategory {
+	var best *ChangeCategory
+	best_count := 0
+	for i := range categories {
+		count := 0
+		for _, files := range [][]string{files_diff.NewFiles, files_diff.ChangedFiles} {
+			for _, file := range files {
+				if matchAnyGlob(categories[i].Paths, file) {
+					count++
+				}
+			}
+		}
+
+		if count > best_count {
+			best = &categories[i]
+			best_count = count
+		}
+	}
+	return best
+}
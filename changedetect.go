@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/udhos/equalfile"
+)
+
+// Attributes considered by getFilesDiff when change_detect isn't configured
+var defaultChangeDetect = []string{"content", "mode"}
+
+// changeDetect is the set of file attributes that count as a change.
+type changeDetect struct {
+	// File content, ignoring line ending differences in text files
+	Content bool
+	// Permission bits, of which git only tracks the executable bit
+	Mode bool
+	// Line ending style of text files
+	Eol bool
+	// Whether the file is a symlink and where it points to
+	Symlink bool
+}
+
+func parseChangeDetect(attrs []string) (changeDetect, error) {
+	if len(attrs) == 0 {
+		attrs = defaultChangeDetect
+	}
+
+	var detect changeDetect
+	for _, attr := range attrs {
+		switch attr {
+		case "content":
+			detect.Content = true
+		case "mode":
+			detect.Mode = true
+		case "eol":
+			detect.Eol = true
+		case "symlink-target":
+			detect.Symlink = true
+		default:
+			return changeDetect{}, fmt.Errorf(
+				"change_detect: unknown attribute %q, expected content, mode, eol or symlink-target",
+				attr,
+			)
+		}
+	}
+
+	return detect, nil
+}
+
+func isExecutable(mode os.FileMode) bool {
+	return mode.Perm()&0111 != 0
+}
+
+// fileMode returns the permissions a managed file whose source has mode is
+// written with, the permission bits of the source.
+func fileMode(mode os.FileMode) os.FileMode {
+	return mode.Perm()
+}
+
+// gitFileMode returns the permissions git records for a file with mode.
+func gitFileMode(mode os.FileMode) os.FileMode {
+	if isExecutable(mode) {
+		return 0755
+	}
+	return 0644
+}
+
+// eolStyle returns "lf", "crlf", "mixed" or "" when content has no newlines.
+func eolStyle(content []byte) string {
+	crlf := bytes.Count(content, []byte("\r\n"))
+	lf := bytes.Count(content, []byte("\n")) - crlf
+	switch {
+	case crlf > 0 && lf > 0:
+		return "mixed"
+	case crlf > 0:
+		return "crlf"
+	case lf > 0:
+		return "lf"
+	}
+	return ""
+}
+
+// fileComparer compares managed files against a repo's files considering only
+// the enabled change attributes. Not safe for concurrent use.
+type fileComparer struct {
+	detect changeDetect
+	cmp    *equalfile.Cmp
+	// Index entries of the clone by path and the files recorded in its
+	// manifest, for the fast paths skipping content comparisons
+	index    map[string]*index.Entry
+	manifest map[string]repoManifestFile
+}
+
+// differences returns the attributes for which repo_file differs from the
+// managed file m. Line endings are always considered for files with
+// configured line endings.
+func (fc *fileComparer) differences(m fileMapping, repo_file string) ([]string, error) {
+	src_info, err := os.Lstat(m.Source)
+	if err != nil {
+		return nil, err
+	}
+	repo_info, err := os.Lstat(repo_file)
+	if err != nil {
+		return nil, err
+	}
+
+	src_link := src_info.Mode()&os.ModeSymlink != 0
+	repo_link := repo_info.Mode()&os.ModeSymlink != 0
+	if fc.detect.Symlink && (src_link || repo_link) {
+		if src_link != repo_link {
+			return []string{"symlink-target"}, nil
+		}
+
+		src_target, err := os.Readlink(m.Source)
+		if err != nil {
+			return nil, err
+		}
+		repo_target, err := os.Readlink(repo_file)
+		if err != nil {
+			return nil, err
+		}
+		if src_target != repo_target {
+			return []string{"symlink-target"}, nil
+		}
+		return nil, nil
+	}
+
+	var diffs []string
+
+	if fc.detect.Mode {
+		src_stat, err := os.Stat(m.Source)
+		if err != nil {
+			return nil, err
+		}
+		repo_stat, err := os.Stat(repo_file)
+		if err != nil {
+			return nil, err
+		}
+		if isExecutable(src_stat.Mode()) != isExecutable(repo_stat.Mode()) {
+			diffs = append(diffs, "mode")
+		}
+	}
+
+	eol := fc.detect.Eol || m.Eol != ""
+	if !fc.detect.Content && !eol {
+		return diffs, nil
+	}
+
+	repo_stat, err := os.Stat(repo_file)
+	if err != nil {
+		return nil, err
+	}
+	equal, err := fc.manifestEqual(m, repo_stat)
+	if err != nil || equal {
+		return diffs, err
+	}
+
+	if fc.detect.Content && !eol && !m.transformed() {
+		src_stat, err := os.Stat(m.Source)
+		if err != nil {
+			return nil, err
+		}
+		repo_stat, err := os.Stat(repo_file)
+		if err != nil {
+			return nil, err
+		}
+
+		equal, ok, err := fc.largeFileEqual(m, repo_file, src_stat, repo_stat)
+		if err != nil {
+			return nil, err
+		}
+		if ok && equal {
+			return diffs, nil
+		}
+		if ok {
+			return append(diffs, "content"), nil
+		}
+	}
+
+	if fc.detect.Content && eol && !m.transformed() {
+		equal, err := fc.cmp.CompareFile(repo_file, m.Source)
+		if err != nil {
+			return nil, err
+		}
+		if equal {
+			return diffs, nil
+		}
+	}
+
+	content, err := m.render()
+	if err != nil {
+		return nil, err
+	}
+	repo_content, err := os.ReadFile(repo_file)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(content, repo_content) {
+		return diffs, nil
+	}
+
+	if isBinary(content) || isBinary(repo_content) {
+		if fc.detect.Content {
+			diffs = append(diffs, "content")
+		}
+		return diffs, nil
+	}
+
+	normalized_equal := bytes.Equal(convertEol(content, "lf"), convertEol(repo_content, "lf"))
+	if fc.detect.Content && !normalized_equal {
+		diffs = append(diffs, "content")
+	} else if eol && normalized_equal {
+		diffs = append(diffs, "eol")
+	} else if eol && eolStyle(content) != eolStyle(repo_content) {
+		diffs = append(diffs, "eol")
+	}
+
+	return diffs, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/udhos/equalfile"
+)
+
+func TestModeDifferences(t *testing.T) {
+	tests := []struct {
+		name        string
+		source_mode os.FileMode
+		repo_mode   os.FileMode
+		detect      changeDetect
+		want        bool
+	}{
+		{name: "same", source_mode: 0644, repo_mode: 0644, detect: changeDetect{Mode: true}, want: false},
+		{name: "same executable", source_mode: 0755, repo_mode: 0755, detect: changeDetect{Mode: true}, want: false},
+		{name: "made executable", source_mode: 0755, repo_mode: 0644, detect: changeDetect{Mode: true}, want: true},
+		{name: "no longer executable", source_mode: 0644, repo_mode: 0755, detect: changeDetect{Mode: true}, want: true},
+		{name: "group writable", source_mode: 0664, repo_mode: 0644, detect: changeDetect{Mode: true}, want: false},
+		{name: "private", source_mode: 0600, repo_mode: 0644, detect: changeDetect{Mode: true, Content: true}, want: false},
+		{name: "executable by owner only", source_mode: 0744, repo_mode: 0644, detect: changeDetect{Mode: true}, want: true},
+		{name: "mode not detected", source_mode: 0755, repo_mode: 0644, detect: changeDetect{Content: true}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "source.sh")
+			repo_file := filepath.Join(dir, "repo.sh")
+			writeTestFile(t, source, "echo hi\n", test.source_mode)
+			writeTestFile(t, repo_file, "echo hi\n", test.repo_mode)
+
+			fc := &fileComparer{detect: test.detect}
+			diffs, err := fc.differences(fileMapping{Source: source, Dest: "repo.sh"}, repo_file)
+			if err != nil {
+				t.Fatalf("differences() failed: %v", err)
+			}
+			if got := slices.Contains(diffs, "mode"); got != test.want {
+				t.Errorf("differences() = %v, want a mode change %v", diffs, test.want)
+			}
+			if slices.Contains(diffs, "content") {
+				t.Errorf("differences() = %v, want no content change", diffs)
+			}
+		})
+	}
+}
+
+func TestParseChangeDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		attrs    []string
+		want     changeDetect
+		want_err bool
+	}{
+		{name: "default", attrs: nil, want: changeDetect{Content: true, Mode: true}},
+		{name: "content only", attrs: []string{"content"}, want: changeDetect{Content: true}},
+		{
+			name:  "all",
+			attrs: []string{"content", "mode", "eol", "symlink-target"},
+			want:  changeDetect{Content: true, Mode: true, Eol: true, Symlink: true},
+		},
+		{name: "unknown", attrs: []string{"owner"}, want_err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseChangeDetect(test.attrs)
+			if test.want_err {
+				if err == nil {
+					t.Fatalf("parseChangeDetect(%v) = %+v, want an error", test.attrs, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseChangeDetect(%v) failed: %v", test.attrs, err)
+			}
+			if got != test.want {
+				t.Errorf("parseChangeDetect(%v) = %+v, want %+v", test.attrs, got, test.want)
+			}
+		})
+	}
+}
+
+func TestEolDifferences(t *testing.T) {
+	content_eol := changeDetect{Content: true, Eol: true}
+
+	tests := []struct {
+		name   string
+		source string
+		repo   string
+		detect changeDetect
+		// Configured line endings of the file
+		eol  string
+		want []string
+	}{
+		{name: "content ignores eol", source: "a\nb\n", repo: "a\r\nb\r\n", detect: changeDetect{Content: true}},
+		{name: "eol only", source: "a\nb\n", repo: "a\r\nb\r\n", detect: changeDetect{Eol: true}, want: []string{"eol"}},
+		{name: "content and eol", source: "a\nb\n", repo: "a\r\nb\r\n", detect: content_eol, want: []string{"eol"}},
+		{name: "mixed in repo", source: "a\nb\n", repo: "a\r\nb\n", detect: content_eol, want: []string{"eol"}},
+		{name: "content wins", source: "a\nb\n", repo: "a\r\nc\r\n", detect: content_eol, want: []string{"content"}},
+		{name: "eol only same style", source: "a\nb\n", repo: "a\nc\n", detect: changeDetect{Eol: true}},
+		{name: "eol only both differ", source: "a\nb\n", repo: "a\r\nc\r\n", detect: changeDetect{Eol: true}, want: []string{"eol"}},
+		{name: "equal", source: "a\r\nb\r\n", repo: "a\r\nb\r\n", detect: content_eol},
+		{name: "configured crlf matches", source: "a\nb\n", repo: "a\r\nb\r\n", detect: changeDetect{Content: true}, eol: "crlf"},
+		{name: "configured crlf differs", source: "a\nb\n", repo: "a\nb\n", detect: changeDetect{Content: true}, eol: "crlf", want: []string{"eol"}},
+		{name: "configured lf differs", source: "a\r\nb\r\n", repo: "a\r\nb\r\n", detect: changeDetect{Content: true}, eol: "lf", want: []string{"eol"}},
+		{name: "binary", source: "\x00a\n", repo: "\x00a\r\n", detect: content_eol, want: []string{"content"}},
+		{name: "binary eol only", source: "\x00a\n", repo: "\x00a\r\n", detect: changeDetect{Eol: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "source.txt")
+			repo_file := filepath.Join(dir, "repo.txt")
+			writeTestFile(t, source, test.source, 0644)
+			writeTestFile(t, repo_file, test.repo, 0644)
+
+			fc := &fileComparer{
+				detect: test.detect,
+				cmp:    equalfile.NewMultiple(nil, equalfile.Options{}, sha256.New(), true),
+			}
+			diffs, err := fc.differences(fileMapping{Source: source, Dest: "repo.txt", Eol: test.eol}, repo_file)
+			if err != nil {
+				t.Fatalf("differences() failed: %v", err)
+			}
+			if !slices.Equal(diffs, test.want) {
+				t.Errorf("differences() = %v, want %v", diffs, test.want)
+			}
+		})
+	}
+}
+
+func TestSymlinkDifferences(t *testing.T) {
+	symlink_content := changeDetect{Content: true, Symlink: true}
+
+	tests := []struct {
+		name string
+		// Link target of the source and repo file, a regular file if empty
+		source_link string
+		repo_link   string
+		detect      changeDetect
+		want        []string
+	}{
+		{name: "same target", source_link: "target.txt", repo_link: "target.txt", detect: symlink_content},
+		{name: "other target", source_link: "target.txt", repo_link: "other.txt", detect: symlink_content, want: []string{"symlink-target"}},
+		{name: "source is a link", source_link: "target.txt", detect: symlink_content, want: []string{"symlink-target"}},
+		{name: "repo is a link", repo_link: "target.txt", detect: symlink_content, want: []string{"symlink-target"}},
+		{name: "regular files", detect: changeDetect{Content: true, Eol: true, Symlink: true}, want: []string{"eol"}},
+		// Only the link target is compared, not the line endings of the
+		// files they point to
+		{name: "same target eol", source_link: "target.txt", repo_link: "target.txt", detect: changeDetect{Content: true, Eol: true, Symlink: true}},
+		{name: "eol without symlink", source_link: "target.txt", repo_link: "target.txt", detect: changeDetect{Content: true, Eol: true}, want: []string{"eol"}},
+		{name: "other target without symlink", source_link: "target.txt", repo_link: "other.txt", detect: changeDetect{Content: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// Targets resolve next to each link, so the source and repo
+			// targets only differ in line endings
+			for _, side := range []struct {
+				dir     string
+				link    string
+				content string
+			}{
+				{dir: filepath.Join(dir, "source"), link: test.source_link, content: "a\nb\n"},
+				{dir: filepath.Join(dir, "repo"), link: test.repo_link, content: "a\r\nb\r\n"},
+			} {
+				writeTestFile(t, filepath.Join(side.dir, "target.txt"), side.content, 0644)
+				writeTestFile(t, filepath.Join(side.dir, "other.txt"), side.content, 0644)
+				if side.link == "" {
+					writeTestFile(t, filepath.Join(side.dir, "file.txt"), side.content, 0644)
+				} else if err := os.Symlink(side.link, filepath.Join(side.dir, "file.txt")); err != nil {
+					t.Skipf("symlinks aren't supported: %v", err)
+				}
+			}
+
+			fc := &fileComparer{
+				detect: test.detect,
+				cmp:    equalfile.NewMultiple(nil, equalfile.Options{}, sha256.New(), true),
+			}
+			source := filepath.Join(dir, "source", "file.txt")
+			diffs, err := fc.differences(fileMapping{Source: source, Dest: "file.txt"}, filepath.Join(dir, "repo", "file.txt"))
+			if err != nil {
+				t.Fatalf("differences() failed: %v", err)
+			}
+			if !slices.Equal(diffs, test.want) {
+				t.Errorf("differences() = %v, want %v", diffs, test.want)
+			}
+		})
+	}
+}
+
+// writeTestFile writes content to file_path with exactly mode, regardless of
+// the umask.
+func writeTestFile(t testing.TB, file_path string, content string, mode os.FileMode) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(file_path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(file_path, []byte(content), mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chmod(file_path, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
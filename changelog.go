@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// changelogEntry is a set of managed file changes and the repos that
+// received exactly that set.
+type changelogEntry struct {
+	New     []string
+	Changed []string
+	Repos   []string
+}
+
+func (e *changelogEntry) key() string {
+	return strings.Join(e.New, "\x00") + "\x01" + strings.Join(e.Changed, "\x00")
+}
+
+// changelog collects the changes synced to each repo during a run, keyed by
+// source file so repos with templated destinations are grouped together.
+type changelog struct {
+	mu      sync.Mutex
+	entries []*changelogEntry
+}
+
+func newChangelog() *changelog {
+	return &changelog{}
+}
+
+func sourcePaths(files_dir string, files_diff *FilesDiff, files []string) []string {
+	var sources []string
+	for _, file_rel := range files {
+		sources = append(sources, managedRelPath(files_dir, files_diff.Mappings[file_rel].Source))
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// add records the files synced to repo_name from files_dir. A nil changelog
+// ignores it.
+func (l *changelog) add(repo_name string, files_dir string, files_diff *FilesDiff) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := &changelogEntry{
+		New:     sourcePaths(files_dir, files_diff, files_diff.NewFiles),
+		Changed: sourcePaths(files_dir, files_diff, files_diff.ChangedFiles),
+	}
+
+	for _, existing := range l.entries {
+		if existing.key() == entry.key() {
+			existing.Repos = append(existing.Repos, repo_name)
+			return
+		}
+	}
+
+	entry.Repos = []string{repo_name}
+	l.entries = append(l.entries, entry)
+}
+
+// render formats the changelog as markdown, the changes received by the most
+// repos first.
+func (l *changelog) render() string {
+	entries := slices.Clone(l.entries)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return len(entries[i].Repos) > len(entries[j].Repos)
+	})
+
+	var b strings.Builder
+	b.WriteString("# Synced changes\n")
+	if len(entries) == 0 {
+		b.WriteString("\nNo repos were changed.\n")
+	}
+
+	for _, entry := range entries {
+		b.WriteString("\n")
+		for _, file := range entry.New {
+			fmt.Fprintf(&b, "- Added `%s`\n", file)
+		}
+		for _, file := range entry.Changed {
+			fmt.Fprintf(&b, "- Updated `%s`\n", file)
+		}
+
+		repos := slices.Clone(entry.Repos)
+		sort.Strings(repos)
+		fmt.Fprintf(&b, "\nRepos: %s\n", strings.Join(repos, ", "))
+	}
+
+	return b.String()
+}
+
+func (l *changelog) write(path string) error {
+	return os.WriteFile(path, []byte(l.render()), 0644)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// changelogDiff is the diff of a repo whose destination paths are the source
+// paths, except for ci.yml which is templated with the repo name.
+func changelogDiff(repo_name string, new_files []string, changed_files []string) *FilesDiff {
+	files_diff := &FilesDiff{Mappings: map[string]fileMapping{}}
+	dest := func(file_rel string) string {
+		if file_rel == "ci.yml" {
+			return ".github/" + repo_name + ".yml"
+		}
+		return file_rel
+	}
+	for _, file_rel := range new_files {
+		files_diff.NewFiles = append(files_diff.NewFiles, dest(file_rel))
+		files_diff.Mappings[dest(file_rel)] = fileMapping{Source: filepath.Join("files", file_rel)}
+	}
+	for _, file_rel := range changed_files {
+		files_diff.ChangedFiles = append(files_diff.ChangedFiles, dest(file_rel))
+		files_diff.Mappings[dest(file_rel)] = fileMapping{Source: filepath.Join("files", file_rel)}
+	}
+	return files_diff
+}
+
+func TestChangelog(t *testing.T) {
+	tests := []struct {
+		name string
+		add  func(l *changelog)
+		want string
+	}{
+		{
+			name: "empty",
+			add:  func(l *changelog) {},
+			want: "# Synced changes\n\nNo repos were changed.\n",
+		},
+		{
+			name: "grouped by changes",
+			add: func(l *changelog) {
+				l.add("ecsact_parse", "files", changelogDiff("ecsact_parse", []string{"LICENSE"}, nil))
+				l.add("ecsact_runtime", "files", changelogDiff("ecsact_runtime", nil, []string{"README.md"}))
+				l.add("ecsact_cli", "files", changelogDiff("ecsact_cli", nil, []string{"README.md"}))
+			},
+			want: "# Synced changes\n" +
+				"\n- Updated `README.md`\n\nRepos: ecsact_cli, ecsact_runtime\n" +
+				"\n- Added `LICENSE`\n\nRepos: ecsact_parse\n",
+		},
+		{
+			name: "templated destinations",
+			add: func(l *changelog) {
+				l.add("ecsact_cli", "files", changelogDiff("ecsact_cli", []string{"ci.yml"}, nil))
+				l.add("ecsact_runtime", "files", changelogDiff("ecsact_runtime", []string{"ci.yml"}, nil))
+			},
+			want: "# Synced changes\n\n- Added `ci.yml`\n\nRepos: ecsact_cli, ecsact_runtime\n",
+		},
+		{
+			name: "new and changed differ",
+			add: func(l *changelog) {
+				l.add("ecsact_cli", "files", changelogDiff("ecsact_cli", []string{"README.md"}, nil))
+				l.add("ecsact_runtime", "files", changelogDiff("ecsact_runtime", nil, []string{"README.md"}))
+			},
+			want: "# Synced changes\n" +
+				"\n- Added `README.md`\n\nRepos: ecsact_cli\n" +
+				"\n- Updated `README.md`\n\nRepos: ecsact_runtime\n",
+		},
+		{
+			name: "sorted files",
+			add: func(l *changelog) {
+				l.add("ecsact_cli", "files", changelogDiff("ecsact_cli", []string{"b.txt", "a.txt"}, []string{"d.txt", "c.txt"}))
+			},
+			want: "# Synced changes\n\n" +
+				"- Added `a.txt`\n- Added `b.txt`\n- Updated `c.txt`\n- Updated `d.txt`\n" +
+				"\nRepos: ecsact_cli\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := newChangelog()
+			test.add(l)
+			if got := l.render(); got != test.want {
+				t.Errorf("render() = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	var no_changelog *changelog
+	no_changelog.add("ecsact_cli", "files", changelogDiff("ecsact_cli", []string{"a.txt"}, nil))
+}
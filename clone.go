@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// isIncompleteClone reports whether dir exists but doesn't hold a usable
+// repository, as left behind by an interrupted clone.
+func isIncompleteClone(dir string) bool {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return false
+	}
+
+	if _, err := os.Stat(dir + "/.git/HEAD"); err != nil {
+		return true
+	}
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return true
+	}
+
+	_, err = repo.Head()
+	return err != nil
+}
+
+// repoCloneDir returns the directory repo_name is cloned into and a function
+// removing it once the repo is processed. With -keep-clones it's the reused
+// ./clones/<repo>, otherwise a new temporary directory.
+func repoCloneDir(repo_name string) (string, func(), error) {
+	if *keepClones {
+		return filepath.Join("clones", repo_name), func() {}, nil
+	}
+
+	tmp_dir, err := os.MkdirTemp("", "ecsact_common-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	cleanup := func() {
+		err := os.RemoveAll(tmp_dir)
+		if err != nil {
+			logWarn("removing clone of %s failed: %s", repo_name, err)
+		}
+	}
+	return filepath.Join(tmp_dir, repo_name), cleanup, nil
+}
+
+// cloneRepo clones url into dir with branch checked out. An existing clone in
+// dir is reused by resetting it to the latest branch from url, whatever an
+// interrupted clone left in dir is removed first.
+func cloneRepo(dir string, url string, branch string) (*git.Repository, error) {
+	if isIncompleteClone(dir) {
+		logInfo("Removing incomplete clone %s", dir)
+		err := os.RemoveAll(dir)
+		if err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(dir); err == nil {
+		repo, err := resetClone(dir, url, branch)
+		if err == nil {
+			return repo, nil
+		}
+
+		logInfo("Reusing clone %s failed, cloning again: %s", dir, err)
+		err = os.RemoveAll(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var repo *git.Repository
+	err := withRetries("clone into "+dir, func() error {
+		var err error
+		repo, err = git.PlainCloneContext(runCtx, dir, false, &git.CloneOptions{
+			URL:           url,
+			ReferenceName: plumbing.NewBranchReferenceName(branch),
+			Auth:          gitAuth,
+		})
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+		return err
+	})
+	return repo, err
+}
+
+// resetClone fetches url into the existing clone in dir and hard resets it to
+// branch, dropping local branches and untracked files left by earlier runs.
+func resetClone(dir string, url string, branch string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The URL may change between runs, e.g. when it embeds a token
+	err = repo.DeleteRemote("origin")
+	if err != nil && err != git.ErrRemoteNotFound {
+		return nil, err
+	}
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.FetchContext(runCtx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		Auth:       gitAuth,
+		Force:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+
+	remote_ref, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in origin: %w", branch, err)
+	}
+
+	branch_ref := plumbing.NewBranchReferenceName(branch)
+	err = repo.Storer.SetReference(plumbing.NewHashReference(branch_ref, remote_ref.Hash()))
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	err = worktree.Checkout(&git.CheckoutOptions{
+		Branch: branch_ref,
+		Force:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = worktree.Reset(&git.ResetOptions{
+		Commit: remote_ref.Hash(),
+		Mode:   git.HardReset,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = worktree.Clean(&git.CleanOptions{Dir: true})
+	if err != nil {
+		return nil, err
+	}
+
+	branches, err := repo.Branches()
+	if err != nil {
+		return nil, err
+	}
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() == branch_ref {
+			return nil
+		}
+		return repo.Storer.RemoveReference(ref.Name())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsIncompleteClone(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	remote := newTestRemote(t, map[string]string{"README.md": "# alpha\n"})
+
+	tests := []struct {
+		name string
+		// Prepares dir, which doesn't exist yet
+		setup func(t *testing.T, dir string)
+		want  bool
+	}{
+		{
+			name:  "missing",
+			setup: func(t *testing.T, dir string) {},
+			want:  false,
+		},
+		{
+			name: "empty dir",
+			setup: func(t *testing.T, dir string) {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: true,
+		},
+		{
+			name: "no HEAD",
+			setup: func(t *testing.T, dir string) {
+				if err := os.MkdirAll(filepath.Join(dir, ".git", "objects"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: true,
+		},
+		{
+			name: "no commits",
+			setup: func(t *testing.T, dir string) {
+				testGit(t, filepath.Dir(dir), "init", "-q", "-b", "main", dir)
+			},
+			want: true,
+		},
+		{
+			name: "complete",
+			setup: func(t *testing.T, dir string) {
+				testGit(t, filepath.Dir(dir), "clone", "-q", remote, dir)
+			},
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "ecsact_cli")
+			test.setup(t, dir)
+
+			if got := isIncompleteClone(dir); got != test.want {
+				t.Errorf("isIncompleteClone() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestCloneRepo clones over an interrupted clone, then reuses the clone,
+// dropping what an earlier run left in it.
+func TestCloneRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	remote := newTestRemote(t, map[string]string{"README.md": "# alpha\n"})
+	dir := filepath.Join(t.TempDir(), "ecsact_cli")
+
+	// An interrupted clone leaves a .git without HEAD
+	writeTestFile(t, filepath.Join(dir, ".git", "config"), "", 0644)
+	writeTestFile(t, filepath.Join(dir, "partial"), "", 0644)
+
+	_, err := cloneRepo(dir, remote, "main")
+	if err != nil {
+		t.Fatalf("cloneRepo() over an incomplete clone failed: %v", err)
+	}
+	if isIncompleteClone(dir) {
+		t.Fatal("cloneRepo() left an incomplete clone")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partial")); !os.IsNotExist(err) {
+		t.Errorf("cloneRepo() kept a file of the incomplete clone")
+	}
+
+	writeTestFile(t, filepath.Join(dir, "README.md"), "local edit\n", 0644)
+	writeTestFile(t, filepath.Join(dir, "untracked"), "", 0644)
+
+	_, err = cloneRepo(dir, remote, "main")
+	if err != nil {
+		t.Fatalf("cloneRepo() reusing the clone failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "# alpha\n" {
+		t.Errorf("reused clone has README.md %q, want the remote content", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "untracked")); !os.IsNotExist(err) {
+		t.Errorf("cloneRepo() kept an untracked file of the reused clone")
+	}
+}
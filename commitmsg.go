@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitMessageData is available to the commit_message template.
+type commitMessageData struct {
+	RepoName string
+	// Tier of the repo from the repos_url inventory, if any
+	Tier           string
+	PrTitle        string
+	SourceSha      string
+	SourceShortSha string
+	NewFiles       []string
+	ChangedFiles   []string
+	RemovedFiles   []string
+	New            int
+	Changed        int
+	Removed        int
+	// The full diff, for templates needing mappings or hashes
+	FilesDiff *FilesDiff
+}
+
+// sourceSha returns the commit of the repo containing the working directory,
+// i.e. of ecsact_common itself, or an empty string if there isn't one.
+func sourceSha() string {
+	repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{
+		DetectDotGit: true,
+	})
+	if err != nil {
+		return ""
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return ""
+	}
+
+	return head.Hash().String()
+}
+
+// renderCommitMessage renders the configured commit message for repo_name,
+// defaulting to the PR title.
+func renderCommitMessage(
+	c *Config,
+	repo_name string,
+	source_sha string,
+	files_diff *FilesDiff,
+) (string, error) {
+	if c.CommitMessage == "" {
+		return c.PrTitle, nil
+	}
+
+	tmpl, err := template.New("commit_message").Parse(c.CommitMessage)
+	if err != nil {
+		return "", err
+	}
+
+	short_sha := source_sha
+	if len(short_sha) > 7 {
+		short_sha = short_sha[:7]
+	}
+
+	var msg strings.Builder
+	err = tmpl.Execute(&msg, commitMessageData{
+		RepoName:       repo_name,
+		Tier:           c.Inventory[repo_name].Tier,
+		PrTitle:        c.PrTitle,
+		SourceSha:      source_sha,
+		SourceShortSha: short_sha,
+		NewFiles:       files_diff.NewFiles,
+		ChangedFiles:   files_diff.ChangedFiles,
+		RemovedFiles:   files_diff.DeletedFiles,
+		New:            len(files_diff.NewFiles),
+		Changed:        len(files_diff.ChangedFiles),
+		Removed:        len(files_diff.DeletedFiles),
+		FilesDiff:      files_diff,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return msg.String(), nil
+}
+
+// checkSourceClean returns an error listing every modified or untracked file
+// in files_dir, so a sync always corresponds to a committed source state.
+func checkSourceClean(files_dir string) error {
+	output, err := runGit(".", "status", "--porcelain", "--untracked-files=all", "--", files_dir)
+	if err != nil {
+		return err
+	}
+
+	status := strings.TrimRight(string(output), "\n")
+	if status == "" {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%s has uncommitted changes, commit them or pass -allow-dirty:\n%s",
+		files_dir, status,
+	)
+}
+
+// appendSignoff adds a Signed-off-by trailer for signature to msg unless it's
+// already present.
+func appendSignoff(msg string, signature *object.Signature) string {
+	trailer := fmt.Sprintf("Signed-off-by: %s <%s>", signature.Name, signature.Email)
+
+	msg = strings.TrimRight(msg, "\n")
+	lines := strings.Split(msg, "\n")
+	if slices.Contains(lines, trailer) {
+		return msg
+	}
+
+	last_line := lines[len(lines)-1]
+	if len(lines) > 1 && strings.HasPrefix(last_line, "Signed-off-by: ") {
+		return msg + "\n" + trailer
+	}
+	return msg + "\n\n" + trailer
+}
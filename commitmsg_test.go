@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestAppendSignoff(t *testing.T) {
+	signature := &object.Signature{Name: "seaubot", Email: "seaubot@users.noreply.github.com"}
+	trailer := "Signed-off-by: seaubot <seaubot@users.noreply.github.com>"
+
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{name: "subject only", msg: "chore: sync", want: "chore: sync\n\n" + trailer},
+		{name: "trailing newlines", msg: "chore: sync\n\n", want: "chore: sync\n\n" + trailer},
+		{name: "body", msg: "chore: sync\n\nSynced files.", want: "chore: sync\n\nSynced files.\n\n" + trailer},
+		{name: "already signed", msg: "chore: sync\n\n" + trailer + "\n", want: "chore: sync\n\n" + trailer},
+		{
+			name: "other signoff",
+			msg:  "chore: sync\n\nSigned-off-by: someone <someone@example.com>",
+			want: "chore: sync\n\nSigned-off-by: someone <someone@example.com>\n" + trailer,
+		},
+		{
+			name: "signoff as subject",
+			msg:  "Signed-off-by: someone <someone@example.com>",
+			want: "Signed-off-by: someone <someone@example.com>\n\n" + trailer,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := appendSignoff(test.msg, signature); got != test.want {
+				t.Errorf("appendSignoff(%q) = %q, want %q", test.msg, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderCommitMessage(t *testing.T) {
+	files_diff := &FilesDiff{
+		NewFiles:     []string{"a.txt", "b.txt"},
+		ChangedFiles: []string{"c.txt"},
+		DeletedFiles: []string{"d.txt", "e.txt", "f.txt"},
+	}
+	sha := "0123456789abcdef0123456789abcdef01234567"
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{name: "default", message: "", want: "chore: sync common files"},
+		{name: "counts", message: "sync: {{.New}} new, {{.Changed}} changed, {{.Removed}} removed", want: "sync: 2 new, 1 changed, 3 removed"},
+		{name: "files", message: "{{range .RemovedFiles}}{{.}} {{end}}", want: "d.txt e.txt f.txt "},
+		{name: "source", message: "{{.RepoName}} at {{.SourceShortSha}} of {{.SourceSha}}", want: "ecsact_cli at 0123456 of " + sha},
+		{name: "tier", message: "{{.PrTitle}} ({{.Tier}})", want: "chore: sync common files (tools)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Config{
+				PrTitle:       "chore: sync common files",
+				CommitMessage: test.message,
+				Inventory:     map[string]InventoryRepo{"ecsact_cli": {Tier: "tools"}},
+			}
+			got, err := renderCommitMessage(c, "ecsact_cli", sha, files_diff)
+			if err != nil {
+				t.Fatalf("renderCommitMessage() failed: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("renderCommitMessage() = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	c := &Config{CommitMessage: "{{.Missing}}"}
+	if _, err := renderCommitMessage(c, "ecsact_cli", sha, files_diff); err == nil {
+		t.Error("renderCommitMessage() with an unknown field succeeded")
+	}
+}
+
+func TestCheckSourceClean(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		gitErr  error
+		wantErr string
+	}{
+		{name: "clean", status: ""},
+		{name: "modified", status: " M files/README.md\n", wantErr: "files has uncommitted changes, commit them or pass -allow-dirty:\n M files/README.md"},
+		{
+			name:    "untracked",
+			status:  " M files/README.md\n?? files/new.txt\n",
+			wantErr: "files has uncommitted changes, commit them or pass -allow-dirty:\n M files/README.md\n?? files/new.txt",
+		},
+		{name: "not a repo", gitErr: errors.New("not a git repository"), wantErr: "not a git repository"},
+	}
+
+	defer func(run func(string, ...string) ([]byte, error)) { runGit = run }(runGit)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var args []string
+			runGit = func(dir string, git_args ...string) ([]byte, error) {
+				args = git_args
+				return []byte(test.status), test.gitErr
+			}
+
+			err := checkSourceClean("files")
+			if test.wantErr == "" && err != nil {
+				t.Errorf("checkSourceClean() failed: %v", err)
+			}
+			if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Errorf("checkSourceClean() = %v, want %q", err, test.wantErr)
+			}
+			if want := "status --porcelain --untracked-files=all -- files"; strings.Join(args, " ") != want {
+				t.Errorf("ran git %s, want git %s", strings.Join(args, " "), want)
+			}
+		})
+	}
+}
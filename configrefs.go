@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// unmatchedConfigRefs returns a description of every config path or glob that
+// doesn't match any of the managed files, as these silently do nothing.
+func unmatchedConfigRefs(c *Config, files []string) []string {
+	var files_rel []string
+	for _, file := range files {
+		files_rel = append(files_rel, managedRelPath(c.FilesDir, file))
+	}
+
+	matchesAny := func(match func(string) bool) bool {
+		for _, file_rel := range files_rel {
+			if match(file_rel) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var unmatched []string
+
+	for i, set := range c.FileSets {
+		for _, pattern := range set.Paths {
+			single := FileSet{Paths: []string{pattern}}
+			if !matchesAny(single.contains) {
+				unmatched = append(unmatched, fmt.Sprintf("file_sets[%d].paths: %q", i, pattern))
+			}
+		}
+	}
+
+	for i, fragment := range c.PrBodyFragments {
+		for _, pattern := range fragment.Paths {
+			if !matchesAny(func(file_rel string) bool { return matchGlob(pattern, file_rel) }) {
+				unmatched = append(unmatched, fmt.Sprintf("pr_body_fragments[%d].paths: %q", i, pattern))
+			}
+		}
+	}
+
+	var mapping_sources []string
+	for source_rel := range c.Mappings {
+		mapping_sources = append(mapping_sources, source_rel)
+	}
+	sort.Strings(mapping_sources)
+	for _, source_rel := range mapping_sources {
+		if !matchesAny(func(file_rel string) bool { return file_rel == source_rel }) {
+			unmatched = append(unmatched, fmt.Sprintf("mappings: %q", source_rel))
+		}
+	}
+
+	var eol_patterns []string
+	for pattern := range c.Eol {
+		eol_patterns = append(eol_patterns, pattern)
+	}
+	sort.Strings(eol_patterns)
+	for _, pattern := range eol_patterns {
+		if !matchesAny(func(file_rel string) bool { return matchGlob(pattern, file_rel) }) {
+			unmatched = append(unmatched, fmt.Sprintf("eol: %q", pattern))
+		}
+	}
+
+	return unmatched
+}
+
+// checkConfigRefs warns about config references that match no managed file,
+// or fails when strict is set.
+func checkConfigRefs(c *Config, files []string, strict bool) error {
+	unmatched := unmatchedConfigRefs(c, files)
+	if strict && len(unmatched) > 0 {
+		return fmt.Errorf("config references match no file in %s: %v", c.FilesDir, unmatched)
+	}
+
+	for _, ref := range unmatched {
+		logWarn("%s matches no file in %s", ref, c.FilesDir)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUnmatchedConfigRefs(t *testing.T) {
+	files := []string{"files/README.md", "files/.github/workflows/main.yml", "files/build.bat"}
+
+	tests := []struct {
+		name string
+		c    *Config
+		want []string
+	}{
+		{name: "no refs", c: &Config{}},
+		{
+			name: "all matched",
+			c: &Config{
+				FileSets:        []FileSet{{Paths: []string{".github/workflows/", "*.md"}}},
+				PrBodyFragments: []PrBodyFragment{{Paths: []string{".github/**"}}},
+				Mappings:        map[string]string{"README.md": "docs/README.md"},
+				Eol:             map[string]string{"*.bat": "crlf"},
+			},
+		},
+		{
+			name: "unmatched",
+			c: &Config{
+				FileSets:        []FileSet{{Paths: []string{"*.md"}}, {Paths: []string{".github/actions/", "*.md"}}},
+				PrBodyFragments: []PrBodyFragment{{Paths: []string{"docs/**"}}},
+				Mappings:        map[string]string{"README.md": "a.md", "READNE.md": "b.md", "CONTRIBUTING.md": "c.md"},
+				Eol:             map[string]string{"*.cmd": "crlf", "*.bat": "crlf", "*.ps1": "crlf"},
+			},
+			want: []string{
+				`file_sets[1].paths: ".github/actions/"`,
+				`pr_body_fragments[0].paths: "docs/**"`,
+				`mappings: "CONTRIBUTING.md"`,
+				`mappings: "READNE.md"`,
+				`eol: "*.cmd"`,
+				`eol: "*.ps1"`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.c.FilesDir = "files"
+			if got := unmatchedConfigRefs(test.c, files); !slices.Equal(got, test.want) {
+				t.Errorf("unmatchedConfigRefs() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckConfigRefs(t *testing.T) {
+	files := []string{"files/README.md"}
+
+	tests := []struct {
+		name    string
+		c       *Config
+		strict  bool
+		wantErr bool
+		wantLog string
+	}{
+		{name: "matched", c: &Config{Mappings: map[string]string{"README.md": "a.md"}}, strict: true},
+		{
+			name:    "warned",
+			c:       &Config{Mappings: map[string]string{"READNE.md": "a.md"}},
+			wantLog: `mappings: "READNE.md" matches no file in files`,
+		},
+		{name: "strict", c: &Config{Mappings: map[string]string{"READNE.md": "a.md"}}, strict: true, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.c.FilesDir = "files"
+			var err error
+			output := captureStdout(t, func() { err = checkConfigRefs(test.c, files, test.strict) })
+
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkConfigRefs() = %v, want an error %v", err, test.wantErr)
+			}
+			if test.wantErr && !strings.Contains(err.Error(), "READNE.md") {
+				t.Errorf("checkConfigRefs() = %v, want the unmatched reference", err)
+			}
+			if test.wantLog == "" && output != "" {
+				t.Errorf("checkConfigRefs() logged %q, want nothing", output)
+			}
+			if !strings.Contains(output, test.wantLog) {
+				t.Errorf("checkConfigRefs() logged %q, want %q", output, test.wantLog)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DedupeConfig controls which open PRs -dedupe-prs considers to be sync PRs.
+// Both patterns are regular expressions and a PR matching either is a sync
+// PR. Without patterns PRs titled PrTitle or opened from a sync branch match.
+type DedupeConfig struct {
+	TitlePattern  string `yaml:"title_pattern"`
+	BranchPattern string `yaml:"branch_pattern"`
+	// Comment left on every duplicate PR before closing it
+	Comment string `yaml:"comment"`
+}
+
+type openPr struct {
+	Number      int    `json:"number"`
+	Title       string `json:"title"`
+	HeadRefName string `json:"headRefName"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+type syncPrMatcher struct {
+	title  *regexp.Regexp
+	branch *regexp.Regexp
+}
+
+func newSyncPrMatcher(c *Config) (*syncPrMatcher, error) {
+	title_pattern := c.Dedupe.TitlePattern
+	branch_pattern := c.Dedupe.BranchPattern
+	if title_pattern == "" && branch_pattern == "" {
+		title_pattern = "^" + regexp.QuoteMeta(c.PrTitle) + "$"
+		branch := regexp.QuoteMeta(c.syncBranch("{repo}"))
+		branch_pattern = "^" + strings.ReplaceAll(branch, regexp.QuoteMeta("{repo}"), ".+") + "(-.*)?$"
+	}
+
+	matcher := &syncPrMatcher{}
+	var err error
+	if title_pattern != "" {
+		matcher.title, err = regexp.Compile(title_pattern)
+		if err != nil {
+			return nil, fmt.Errorf("dedupe title_pattern: %w", err)
+		}
+	}
+	if branch_pattern != "" {
+		matcher.branch, err = regexp.Compile(branch_pattern)
+		if err != nil {
+			return nil, fmt.Errorf("dedupe branch_pattern: %w", err)
+		}
+	}
+
+	return matcher, nil
+}
+
+func (m *syncPrMatcher) matches(pr openPr) bool {
+	return (m.title != nil && m.title.MatchString(pr.Title)) ||
+		(m.branch != nil && m.branch.MatchString(pr.HeadRefName))
+}
+
+// duplicatePrs returns every matching PR except for the most recently created
+// one, which is returned as keep.
+func duplicatePrs(prs []openPr, matcher *syncPrMatcher) (keep *openPr, duplicates []openPr) {
+	var matching []openPr
+	for _, pr := range prs {
+		if matcher.matches(pr) {
+			matching = append(matching, pr)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		if matching[i].CreatedAt != matching[j].CreatedAt {
+			return matching[i].CreatedAt > matching[j].CreatedAt
+		}
+		return matching[i].Number > matching[j].Number
+	})
+
+	return &matching[0], matching[1:]
+}
+
+func listOpenPrs(repo string, author string) ([]openPr, error) {
+	output, err := runGh(
+		"pr", "list",
+		"-R", orgRepo(repo),
+		"--state", "open",
+		"--author", author,
+		"--limit", "1000",
+		"--json=number,title,headRefName,createdAt",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var prs []openPr
+	err = json.Unmarshal(output, &prs)
+	if err != nil {
+		return nil, err
+	}
+
+	return prs, nil
+}
+
+func closePr(repo string, pr_num int, comment string) error {
+	args := []string{
+		"pr", "close", strconv.Itoa(pr_num),
+		"-R", orgRepo(repo),
+	}
+	if comment != "" {
+		args = append(args, "-c", comment)
+	}
+
+	_, err := runGh(args...)
+	return err
+}
+
+// dedupeSyncPrs closes all but the most recent open sync PR in repo.
+func dedupeSyncPrs(c *Config, repo string, matcher *syncPrMatcher) error {
+	prs, err := listOpenPrs(repo, c.AuthorLogin)
+	if err != nil {
+		return err
+	}
+
+	keep, duplicates := duplicatePrs(prs, matcher)
+	for _, pr := range duplicates {
+		comment := c.Dedupe.Comment
+		if comment == "" {
+			comment = fmt.Sprintf("Closing in favour of #%d which supersedes this sync PR.", keep.Number)
+		}
+
+		err = closePr(repo, pr.Number, comment)
+		if err != nil {
+			return err
+		}
+		logInfo("closed duplicate %s#%d, keeping #%d", repo, pr.Number, keep.Number)
+	}
+
+	return nil
+}
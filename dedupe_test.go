@@ -0,0 +1,113 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDuplicatePrs(t *testing.T) {
+	c := &Config{PrTitle: "chore: sync with ecsact_common"}
+	default_matcher, err := newSyncPrMatcher(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := c.syncBranch("ecsact_cli")
+
+	tests := []struct {
+		name       string
+		prs        []openPr
+		matcher    *syncPrMatcher
+		want_keep  int
+		duplicates []int
+	}{
+		{
+			name: "none matching",
+			prs: []openPr{
+				{Number: 1, Title: "feat: something", HeadRefName: "feat"},
+			},
+			matcher: default_matcher,
+		},
+		{
+			name: "single",
+			prs: []openPr{
+				{Number: 1, Title: "feat: something", HeadRefName: "feat"},
+				{Number: 2, Title: c.PrTitle, HeadRefName: branch, CreatedAt: "2024-01-01T00:00:00Z"},
+			},
+			matcher:   default_matcher,
+			want_keep: 2,
+		},
+		{
+			name: "newest kept",
+			prs: []openPr{
+				{Number: 3, Title: c.PrTitle, HeadRefName: branch, CreatedAt: "2024-01-01T00:00:00Z"},
+				{Number: 5, Title: c.PrTitle, HeadRefName: branch + "-2", CreatedAt: "2024-03-01T00:00:00Z"},
+				{Number: 4, Title: "renamed", HeadRefName: branch, CreatedAt: "2024-02-01T00:00:00Z"},
+			},
+			matcher:    default_matcher,
+			want_keep:  5,
+			duplicates: []int{4, 3},
+		},
+		{
+			name: "same time by number",
+			prs: []openPr{
+				{Number: 7, Title: c.PrTitle, CreatedAt: "2024-01-01T00:00:00Z"},
+				{Number: 8, Title: c.PrTitle, CreatedAt: "2024-01-01T00:00:00Z"},
+			},
+			matcher:    default_matcher,
+			want_keep:  8,
+			duplicates: []int{7},
+		},
+		{
+			name: "title pattern",
+			prs: []openPr{
+				{Number: 1, Title: "chore: sync files (old)", CreatedAt: "2024-01-01T00:00:00Z"},
+				{Number: 2, Title: "chore: sync files", CreatedAt: "2024-02-01T00:00:00Z"},
+				{Number: 3, Title: c.PrTitle, CreatedAt: "2024-03-01T00:00:00Z"},
+			},
+			matcher:    mustSyncPrMatcher(t, &Config{Dedupe: DedupeConfig{TitlePattern: "^chore: sync files"}}),
+			want_keep:  2,
+			duplicates: []int{1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keep, duplicates := duplicatePrs(test.prs, test.matcher)
+			if test.want_keep == 0 {
+				if keep != nil || len(duplicates) > 0 {
+					t.Errorf("duplicatePrs() = %v, %v, want nothing", keep, duplicates)
+				}
+				return
+			}
+
+			if keep == nil || keep.Number != test.want_keep {
+				t.Errorf("duplicatePrs() keeps %v, want #%d", keep, test.want_keep)
+			}
+			var numbers []int
+			for _, pr := range duplicates {
+				numbers = append(numbers, pr.Number)
+			}
+			if !slices.Equal(numbers, test.duplicates) {
+				t.Errorf("duplicatePrs() duplicates = %v, want %v", numbers, test.duplicates)
+			}
+		})
+	}
+}
+
+func TestNewSyncPrMatcherInvalid(t *testing.T) {
+	for _, dedupe := range []DedupeConfig{{TitlePattern: "("}, {BranchPattern: "["}} {
+		_, err := newSyncPrMatcher(&Config{Dedupe: dedupe})
+		if err == nil {
+			t.Errorf("newSyncPrMatcher(%+v) = nil, want an error", dedupe)
+		}
+	}
+}
+
+func mustSyncPrMatcher(t *testing.T, c *Config) *syncPrMatcher {
+	t.Helper()
+	matcher, err := newSyncPrMatcher(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matcher
+}
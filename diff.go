@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Number of unchanged lines shown around each change in a unified diff.
+const diffContextLines = 3
+
+type diffLine struct {
+	// One of ' ', '-' or '+'
+	Op   byte
+	Text string
+}
+
+// isBinary reports whether content looks like binary data, using the same
+// heuristic as git of looking for a NUL byte near the start.
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) != -1
+}
+
+func diffLines(a string, b string) []diffLine {
+	var lines []diffLine
+	for _, d := range diff.Do(a, b) {
+		var op byte
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			op = ' '
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+
+		for _, line := range strings.SplitAfter(d.Text, "\n") {
+			if line == "" {
+				continue
+			}
+			lines = append(lines, diffLine{Op: op, Text: strings.TrimSuffix(line, "\n")})
+		}
+	}
+	return lines
+}
+
+// unifiedDiff returns a unified diff turning a into b or an empty string if
+// they are equal.
+func unifiedDiff(a_name string, b_name string, a string, b string) string {
+	lines := diffLines(a, b)
+
+	// a_before[i] and b_before[i] are the number of lines of a and b that come
+	// before lines[i]
+	a_before := make([]int, len(lines)+1)
+	b_before := make([]int, len(lines)+1)
+	for i, line := range lines {
+		a_before[i+1] = a_before[i]
+		b_before[i+1] = b_before[i]
+		if line.Op != '+' {
+			a_before[i+1] += 1
+		}
+		if line.Op != '-' {
+			b_before[i+1] += 1
+		}
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(lines); {
+		if lines[i].Op == ' ' {
+			i += 1
+			continue
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", a_name, b_name)
+		}
+
+		// Extend the hunk over changes whose context would overlap
+		last_change := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].Op != ' ' {
+				last_change = j
+			} else if j-last_change > 2*diffContextLines {
+				break
+			}
+		}
+
+		start := max(0, i-diffContextLines)
+		stop := min(len(lines), last_change+diffContextLines+1)
+
+		a_count := a_before[stop] - a_before[start]
+		b_count := b_before[stop] - b_before[start]
+		a_start := a_before[start]
+		b_start := b_before[start]
+		if a_count > 0 {
+			a_start += 1
+		}
+		if b_count > 0 {
+			b_start += 1
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", a_start, a_count, b_start, b_count)
+		for _, line := range lines[start:stop] {
+			out.WriteByte(line.Op)
+			out.WriteString(line.Text)
+			out.WriteByte('\n')
+		}
+
+		i = stop
+	}
+
+	return out.String()
+}
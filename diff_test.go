@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{name: "equal", a: "1\n2\n", b: "1\n2\n", want: ""},
+		{
+			name: "changed line",
+			a:    "1\n2\n3\n",
+			b:    "1\nTWO\n3\n",
+			want: "--- a/x\n+++ b/x\n@@ -1,3 +1,3 @@\n 1\n-2\n+TWO\n 3\n",
+		},
+		{
+			name: "new content",
+			a:    "",
+			b:    "new\n",
+			want: "--- a/x\n+++ b/x\n@@ -0,0 +1,1 @@\n+new\n",
+		},
+		{
+			name: "separate hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			b:    "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			want: "--- a/x\n+++ b/x\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -7,4 +8,3 @@\n 7\n 8\n 9\n-10\n",
+		},
+		{
+			name: "no trailing newline",
+			a:    "1\n2",
+			b:    "1\n3",
+			want: "--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n 1\n-2\n+3\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := unifiedDiff("a/x", "b/x", test.a, test.b)
+			if got != test.want {
+				t.Errorf("unifiedDiff() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    bool
+	}{
+		{name: "text", content: []byte("hello\n"), want: false},
+		{name: "empty", content: nil, want: false},
+		{name: "nul", content: []byte("a\x00b"), want: true},
+		{name: "nul after 8000 bytes", content: []byte(strings.Repeat("a", 8000) + "\x00"), want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isBinary(test.content); got != test.want {
+				t.Errorf("isBinary() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
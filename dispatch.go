@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DispatchConfig enables sending a repository_dispatch event to each repo
+// after its sync PR is created or updated.
+type DispatchConfig struct {
+	EventType string `yaml:"event_type"`
+}
+
+type dispatchPayload struct {
+	EventType     string                `json:"event_type"`
+	ClientPayload dispatchClientPayload `json:"client_payload"`
+}
+
+type dispatchClientPayload struct {
+	Repo         string `json:"repo"`
+	PrNumber     int    `json:"pr_number"`
+	Action       string `json:"action"`
+	NewFiles     int    `json:"new_files"`
+	ChangedFiles int    `json:"changed_files"`
+}
+
+func newDispatchPayload(
+	event_type string,
+	repo_name string,
+	pr_num int,
+	action string,
+	files_diff *FilesDiff,
+) dispatchPayload {
+	return dispatchPayload{
+		EventType: event_type,
+		ClientPayload: dispatchClientPayload{
+			Repo:         repo_name,
+			PrNumber:     pr_num,
+			Action:       action,
+			NewFiles:     len(files_diff.NewFiles),
+			ChangedFiles: len(files_diff.ChangedFiles),
+		},
+	}
+}
+
+// sendDispatch sends payload as a repository_dispatch event to repo_name.
+// Failures are only logged since the sync itself already succeeded.
+func sendDispatch(repo_name string, payload dispatchPayload) {
+	body, err := json.Marshal(payload)
+	if err == nil {
+		_, err = runGhInput(
+			body,
+			"api", "-X", "POST",
+			fmt.Sprintf("repos/%s/dispatches", orgRepo(repo_name)),
+			"--input", "-",
+		)
+	}
+
+	if err != nil {
+		logWarn("repository_dispatch to %s failed: %s", repo_name, err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewDispatchPayload(t *testing.T) {
+	files_diff := &FilesDiff{
+		NewFiles:     []string{"a.txt"},
+		ChangedFiles: []string{"b.txt", "c.txt"},
+		DeletedFiles: []string{"d.txt"},
+	}
+
+	tests := []struct {
+		name   string
+		pr_num int
+		action string
+		want   string
+	}{
+		{
+			name:   "created",
+			pr_num: 12,
+			action: "created",
+			want:   `{"event_type":"common-sync","client_payload":{"repo":"ecsact_cli","pr_number":12,"action":"created","new_files":1,"changed_files":2}}`,
+		},
+		{
+			name:   "updated",
+			pr_num: 7,
+			action: "updated",
+			want:   `{"event_type":"common-sync","client_payload":{"repo":"ecsact_cli","pr_number":7,"action":"updated","new_files":1,"changed_files":2}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := newDispatchPayload("common-sync", "ecsact_cli", test.pr_num, test.action, files_diff)
+			got, err := json.Marshal(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("newDispatchPayload() = %s, want %s", got, test.want)
+			}
+		})
+	}
+
+	payload := newDispatchPayload("common-sync", "ecsact_cli", 1, "created", &FilesDiff{})
+	if payload.ClientPayload.NewFiles != 0 || payload.ClientPayload.ChangedFiles != 0 {
+		t.Errorf("newDispatchPayload() of an empty diff = %+v, want no files", payload.ClientPayload)
+	}
+}
+
+func TestSendDispatch(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "input.json")
+	gh_log := fakeGh(t, "cat > '"+input+"'\n")
+
+	payload := newDispatchPayload("common-sync", "ecsact_cli", 12, "created", &FilesDiff{})
+	sendDispatch("ecsact_cli", payload)
+
+	if got, want := readGhLog(t, gh_log), "api -X POST repos/ecsact-dev/ecsact_cli/dispatches --input -\n"; got != want {
+		t.Errorf("gh calls = %q, want %q", got, want)
+	}
+
+	body, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent dispatchPayload
+	if err := json.Unmarshal(body, &sent); err != nil {
+		t.Fatalf("gh got invalid JSON %q: %v", body, err)
+	}
+	if sent != payload {
+		t.Errorf("gh got %+v, want %+v", sent, payload)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// fileTrace records the rules evaluated for each managed file while deciding
+// whether to sync it and the decision reached. All methods are safe to call on
+// a nil *fileTrace which records nothing.
+type fileTrace struct {
+	mu        sync.Mutex
+	steps     map[string][]string
+	decisions map[string]string
+}
+
+func newFileTrace() *fileTrace {
+	return &fileTrace{
+		steps:     map[string][]string{},
+		decisions: map[string]string{},
+	}
+}
+
+func (t *fileTrace) add(file string, format string, args ...any) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps[file] = append(t.steps[file], fmt.Sprintf(format, args...))
+}
+
+// decide records a step and makes it the current decision for file. Later
+// rules may override an earlier decision.
+func (t *fileTrace) decide(file string, format string, args ...any) {
+	if t == nil {
+		return
+	}
+
+	t.add(file, "decided: "+format, args...)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.decisions[file] = fmt.Sprintf(format, args...)
+}
+
+func (t *fileTrace) print(w io.Writer) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	files := make([]string, 0, len(t.steps))
+	for file := range t.steps {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		fmt.Fprintf(w, "%s\n", file)
+		for _, step := range t.steps[file] {
+			fmt.Fprintf(w, "  %s\n", step)
+		}
+		fmt.Fprintf(w, "  => %s\n", t.decisions[file])
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileTrace(t *testing.T) {
+	trace := newFileTrace()
+	trace.add("b.txt", "matches %d rules", 2)
+	trace.decide("b.txt", "skip (%s)", "excluded")
+	trace.add("a.txt", "not present in repo")
+	trace.decide("a.txt", "skip (ignored)")
+	// Later rules override earlier decisions
+	trace.decide("a.txt", "sync (new)")
+
+	var out strings.Builder
+	trace.print(&out)
+	want := strings.Join([]string{
+		"a.txt",
+		"  not present in repo",
+		"  decided: skip (ignored)",
+		"  decided: sync (new)",
+		"  => sync (new)",
+		"b.txt",
+		"  matches 2 rules",
+		"  decided: skip (excluded)",
+		"  => skip (excluded)",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("print() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	// A nil trace records and prints nothing
+	var nil_trace *fileTrace
+	nil_trace.add("a.txt", "step")
+	nil_trace.decide("a.txt", "skip")
+	out.Reset()
+	nil_trace.print(&out)
+	if out.Len() != 0 {
+		t.Errorf("nil print() = %q, want nothing", out.String())
+	}
+}
+
+// TestExplainExclude checks that the explanation of an excluded file names
+// the exclude rule that fired.
+func TestExplainExclude(t *testing.T) {
+	files_dir := t.TempDir()
+	writeTestFile(t, filepath.Join(files_dir, "README.md"), "# readme\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "notes.txt"), "notes\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, ".editorconfig"), "root = true\n", 0644)
+
+	c := &Config{
+		FilesDir:    files_dir,
+		Exclude:     []string{"*.md"},
+		RepoConfigs: []RepoConfig{{Name: "ecsact_cli", Exclude: []string{"notes.*"}}},
+	}
+	trace := newFileTrace()
+	files, err := managedFiles(c, trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappings, err := resolveMappings(c, "ecsact_cli", filesForRepo(c, files, "ecsact_cli", trace), trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 1 || mappings[0].Dest != ".editorconfig" {
+		t.Fatalf("resolveMappings() = %v, want only .editorconfig", mappings)
+	}
+
+	var out strings.Builder
+	trace.print(&out)
+	for _, want := range []string{
+		"README.md\n  matches exclude glob \"*.md\"\n  decided: skip (excluded)\n  => skip (excluded)\n",
+		"notes.txt\n  matches exclude glob \"notes.*\" for ecsact_cli\n  decided: skip (excluded)\n  => skip (excluded)\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("explanation\n%s\nis missing\n%s", out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FileSet restricts the managed files matching Paths to only be synced to
+// Repos and the repos of Tiers. Managed files that aren't part of any file
+// set are synced to every repo.
+type FileSet struct {
+	// Directories or globs relative to FilesDir
+	Paths []string `yaml:"paths"`
+	Repos []string `yaml:"repos"`
+	// Tiers of the repos_url inventory whose repos the set is synced to
+	Tiers []string `yaml:"tiers"`
+}
+
+// targets reports whether the set is synced to repo_name.
+func (set FileSet) targets(c *Config, repo_name string) bool {
+	return slices.Contains(set.Repos, repo_name) || inTiers(c, repo_name, set.Tiers)
+}
+
+// targetNames describes the repos the set is synced to for traces.
+func (set FileSet) targetNames() []string {
+	names := slices.Clone(set.Repos)
+	for _, tier := range set.Tiers {
+		names = append(names, "tier "+tier)
+	}
+	return names
+}
+
+func (set FileSet) contains(file_rel string) bool {
+	for _, pattern := range set.Paths {
+		pattern = strings.TrimSuffix(pattern, "/")
+		if file_rel == pattern || strings.HasPrefix(file_rel, pattern+"/") {
+			return true
+		}
+		if matchGlob(pattern, file_rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkFileSets(c *Config) error {
+	for i, set := range c.FileSets {
+		for _, repo := range set.Repos {
+			if !slices.Contains(c.Repos, repo) {
+				return fmt.Errorf("file_sets[%d]: %q is not a configured repo", i, repo)
+			}
+		}
+	}
+	return nil
+}
+
+// filesForRepo returns the managed files (as walked from FilesDir) that are
+// synced to repo_name according to the configured file sets.
+func filesForRepo(c *Config, files []string, repo_name string, trace *fileTrace) []string {
+	if len(c.FileSets) == 0 {
+		return files
+	}
+
+	var result []string
+	for _, file := range files {
+		file_rel := managedRelPath(c.FilesDir, file)
+
+		in_any_set := false
+		targeted := false
+		var set_repos []string
+		for _, set := range c.FileSets {
+			if !set.contains(file_rel) {
+				continue
+			}
+			in_any_set = true
+			if set.targets(c, repo_name) {
+				targeted = true
+				break
+			}
+			set_repos = append(set_repos, set.targetNames()...)
+		}
+
+		if !in_any_set || targeted {
+			result = append(result, file)
+		} else {
+			trace.add(file_rel, "file_sets only sync it to %s", strings.Join(set_repos, ", "))
+			trace.decide(file_rel, "skip (not in a file set of %s)", repo_name)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilesForRepo(t *testing.T) {
+	c := &Config{
+		FilesDir: "files",
+		Repos:    []string{"ecsact_cli", "ecsact_runtime", "ecsact_parse"},
+		FileSets: []FileSet{
+			{Paths: []string{".github/workflows/"}, Repos: []string{"ecsact_cli"}},
+			// Overlaps the set above
+			{Paths: []string{".github/workflows/release.yml"}, Repos: []string{"ecsact_runtime"}},
+			{Paths: []string{"*.bazelrc"}, Tiers: []string{"core"}},
+		},
+		Inventory: map[string]InventoryRepo{
+			"ecsact_runtime": {Tier: "core"},
+			"ecsact_parse":   {Tier: "tools"},
+		},
+	}
+	files := []string{
+		"files/README.md",
+		"files/.github/workflows/main.yml",
+		"files/.github/workflows/release.yml",
+		"files/.bazelrc",
+	}
+
+	tests := []struct {
+		repo string
+		want []string
+	}{
+		{
+			repo: "ecsact_cli",
+			want: []string{"files/README.md", "files/.github/workflows/main.yml", "files/.github/workflows/release.yml"},
+		},
+		{
+			repo: "ecsact_runtime",
+			want: []string{"files/README.md", "files/.github/workflows/release.yml", "files/.bazelrc"},
+		},
+		{
+			repo: "ecsact_parse",
+			want: []string{"files/README.md"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.repo, func(t *testing.T) {
+			if got := filesForRepo(c, files, test.repo, nil); !slices.Equal(got, test.want) {
+				t.Errorf("filesForRepo() = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	t.Run("no file sets", func(t *testing.T) {
+		c := &Config{FilesDir: "files"}
+		if got := filesForRepo(c, files, "ecsact_parse", nil); !slices.Equal(got, files) {
+			t.Errorf("filesForRepo() = %v, want every file", got)
+		}
+	})
+}
+
+func TestCheckFileSets(t *testing.T) {
+	c := &Config{
+		Repos:    []string{"ecsact_cli"},
+		FileSets: []FileSet{{Paths: []string{"a"}, Repos: []string{"ecsact_cli"}}},
+	}
+	if err := checkFileSets(c); err != nil {
+		t.Errorf("checkFileSets() failed: %v", err)
+	}
+
+	c.FileSets = append(c.FileSets, FileSet{Paths: []string{"b"}, Repos: []string{"ecsact_cil"}})
+	if err := checkFileSets(c); err == nil {
+		t.Error("checkFileSets() with an unknown repo succeeded")
+	}
+}
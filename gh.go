@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Major version of the gh CLI the commands in this tool are written against.
+const ghSupportedMajor = 2
+
+type ghVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func (v ghVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// ghCommandVariant describes the differences in command construction between
+// gh versions.
+type ghCommandVariant struct {
+	// Whether `gh pr merge --auto` is available
+	AutoMerge bool
+}
+
+// Timeout of a single gh invocation. Set in main() from the config.
+var ghTimeout = 2 * time.Minute
+
+// runGh runs the gh CLI with args and returns its stdout. Each attempt is
+// killed after ghTimeout. Timeouts and transient failures are retried up to
+// retryCount times.
+func runGh(args ...string) ([]byte, error) {
+	return runGhInput(nil, args...)
+}
+
+// runGhInput is runGh with input written to the stdin of gh.
+func runGhInput(input []byte, args ...string) ([]byte, error) {
+	var err error
+	for attempt := 0; attempt <= retryCount; attempt++ {
+		if attempt > 0 {
+			delay, wait_err := retryWait(attempt, err)
+			if wait_err != nil {
+				return nil, wait_err
+			}
+			if err := sleepCtx(delay); err != nil {
+				return nil, err
+			}
+		}
+
+		var output []byte
+		var transient bool
+		output, transient, err = runGhOnce(input, args)
+		if err == nil || !transient {
+			return output, err
+		}
+	}
+
+	return nil, err
+}
+
+func runGhOnce(input []byte, args []string) (output []byte, transient bool, err error) {
+	err = ghDispatcher.acquire()
+	if err != nil {
+		return nil, false, err
+	}
+	defer ghDispatcher.release()
+
+	ctx, cancel := context.WithTimeout(runCtx, ghTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	logCommand("gh", args)
+	cmd := exec.CommandContext(ctx, "gh", args...)
+	cmd.WaitDelay = cancelWaitDelay
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+
+	err = cmd.Run()
+	if runCtx.Err() != nil {
+		return nil, false, fmt.Errorf("gh %s: %w", args[0], runCtx.Err())
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, true, fmt.Errorf("gh %s: timed out after %s", args[0], ghTimeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		return nil, isTransientMessage(msg), fmt.Errorf("gh %s: %w: %s", strings.Join(args, " "), err, msg)
+	}
+
+	return stdout.Bytes(), false, nil
+}
+
+var ghVersionRegexp = regexp.MustCompile(`gh version (\d+)\.(\d+)\.(\d+)`)
+
+// Command variant used for every gh invocation. Selected in main() after
+// detecting the installed gh version.
+var ghVariant = ghCommandVariantFor(ghVersion{Major: ghSupportedMajor})
+
+// parseGhVersion parses the output of `gh --version`, e.g.
+//
+//	gh version 2.32.1 (2023-07-24)
+//	https://github.com/cli/cli/releases/tag/v2.32.1
+func parseGhVersion(output string) (ghVersion, error) {
+	match := ghVersionRegexp.FindStringSubmatch(output)
+	if match == nil {
+		return ghVersion{}, fmt.Errorf("unrecognized gh version output %q", output)
+	}
+
+	var v ghVersion
+	var err error
+	for i, part := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		*part, err = strconv.Atoi(match[i+1])
+		if err != nil {
+			return ghVersion{}, err
+		}
+	}
+
+	return v, nil
+}
+
+func detectGhVersion() (ghVersion, error) {
+	output, err := runGh("--version")
+	if err != nil {
+		return ghVersion{}, err
+	}
+
+	return parseGhVersion(string(output))
+}
+
+// ghCommandVariantFor selects how gh commands are constructed for version v,
+// warning when v is outside of the supported major version.
+func ghCommandVariantFor(v ghVersion) ghCommandVariant {
+	variant := ghCommandVariant{
+		AutoMerge: true,
+	}
+
+	if v.Major < ghSupportedMajor {
+		logWarn(
+			"gh %s is older than the supported %d.x, auto merge will not be enabled",
+			v, ghSupportedMajor,
+		)
+		variant.AutoMerge = false
+	} else if v.Major > ghSupportedMajor {
+		logWarn(
+			"gh %s is newer than the supported %d.x, commands may not behave as expected",
+			v, ghSupportedMajor,
+		)
+	}
+
+	return variant
+}
+
+const reviewThreadsQuery = `
+query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100) {
+        nodes { isResolved }
+      }
+    }
+  }
+}`
+
+// parseUnresolvedReviewThreads counts the unresolved threads in the output of
+// reviewThreadsQuery.
+func parseUnresolvedReviewThreads(output []byte) (int, error) {
+	type ReviewThread struct {
+		IsResolved bool `json:"isResolved"`
+	}
+
+	var response struct {
+		Data struct {
+			Repository struct {
+				PullRequest struct {
+					ReviewThreads struct {
+						Nodes []ReviewThread `json:"nodes"`
+					} `json:"reviewThreads"`
+				} `json:"pullRequest"`
+			} `json:"repository"`
+		} `json:"data"`
+	}
+
+	err := json.Unmarshal(output, &response)
+	if err != nil {
+		return 0, err
+	}
+
+	unresolved := 0
+	for _, thread := range response.Data.Repository.PullRequest.ReviewThreads.Nodes {
+		if !thread.IsResolved {
+			unresolved += 1
+		}
+	}
+
+	return unresolved, nil
+}
+
+// ghFeatures returns the enabled features of c that run gh whatever the
+// pr_client, besides repo_topic which already ran when this is checked.
+func ghFeatures(c *Config) []string {
+	var features []string
+	if c.Dispatch.EventType != "" {
+		features = append(features, "dispatch")
+	}
+	if *closeStale {
+		features = append(features, "-close-stale")
+	}
+	if *pruneBranches {
+		features = append(features, "-prune-branches")
+	}
+	if *dedupePrs {
+		features = append(features, "-dedupe-prs")
+	}
+	return features
+}
+
+func (ghCliPrClient) UnresolvedReviewThreads(repo string, pr_num int) (int, error) {
+	output, err := runGh(
+		"api", "graphql",
+		"-f", "query="+reviewThreadsQuery,
+		"-F", "owner="+githubOrg,
+		"-F", "name="+repo,
+		"-F", fmt.Sprintf("number=%d", pr_num),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseUnresolvedReviewThreads(output)
+}
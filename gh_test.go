@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGhVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		want     ghVersion
+		want_err bool
+	}{
+		{
+			name:   "release",
+			output: "gh version 2.32.1 (2023-07-24)\nhttps://github.com/cli/cli/releases/tag/v2.32.1\n",
+			want:   ghVersion{Major: 2, Minor: 32, Patch: 1},
+		},
+		{name: "without date", output: "gh version 1.14.0\n", want: ghVersion{Major: 1, Minor: 14}},
+		{name: "dev build", output: "gh version 3.0.0-rc.1 (2025-01-01)", want: ghVersion{Major: 3}},
+		{name: "garbage", output: "command not found", want_err: true},
+		{name: "partial", output: "gh version 2.32", want_err: true},
+		{name: "empty", output: "", want_err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseGhVersion(test.output)
+			if test.want_err {
+				if err == nil {
+					t.Fatalf("parseGhVersion(%q) = %v, want an error", test.output, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseGhVersion(%q) failed: %v", test.output, err)
+			}
+			if got != test.want {
+				t.Errorf("parseGhVersion(%q) = %v, want %v", test.output, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGhCommandVariantFor(t *testing.T) {
+	tests := []struct {
+		version ghVersion
+		want    ghCommandVariant
+	}{
+		{version: ghVersion{Major: 1, Minor: 14}, want: ghCommandVariant{AutoMerge: false}},
+		{version: ghVersion{Major: ghSupportedMajor}, want: ghCommandVariant{AutoMerge: true}},
+		{version: ghVersion{Major: ghSupportedMajor, Minor: 40, Patch: 1}, want: ghCommandVariant{AutoMerge: true}},
+		{version: ghVersion{Major: ghSupportedMajor + 1}, want: ghCommandVariant{AutoMerge: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version.String(), func(t *testing.T) {
+			if got := ghCommandVariantFor(test.version); got != test.want {
+				t.Errorf("ghCommandVariantFor(%v) = %+v, want %+v", test.version, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseUnresolvedReviewThreads(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		want     int
+		want_err bool
+	}{
+		{
+			name:   "mixed",
+			output: `{"data":{"repository":{"pullRequest":{"reviewThreads":{"nodes":[{"isResolved":true},{"isResolved":false},{"isResolved":false}]}}}}}`,
+			want:   2,
+		},
+		{
+			name:   "all resolved",
+			output: `{"data":{"repository":{"pullRequest":{"reviewThreads":{"nodes":[{"isResolved":true}]}}}}}`,
+			want:   0,
+		},
+		{
+			name:   "no threads",
+			output: `{"data":{"repository":{"pullRequest":{"reviewThreads":{"nodes":[]}}}}}`,
+			want:   0,
+		},
+		{name: "missing pull request", output: `{"data":{"repository":{"pullRequest":null}}}`, want: 0},
+		{name: "invalid", output: `{"data":`, want_err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseUnresolvedReviewThreads([]byte(test.output))
+			if test.want_err {
+				if err == nil {
+					t.Fatalf("parseUnresolvedReviewThreads() = %d, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseUnresolvedReviewThreads() failed: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("parseUnresolvedReviewThreads() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// readGhLog returns the gh calls logged by a fakeGh, one per line.
+func readGhLog(t *testing.T, gh_log string) string {
+	t.Helper()
+	calls, err := os.ReadFile(gh_log)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(calls)
+}
+
+// fakeGh puts a gh running the shell script on the PATH for the rest of the
+// test. Its arguments are logged to the returned file, one call per line.
+func fakeGh(t *testing.T, script string) string {
+	t.Helper()
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("the fake gh needs /bin/sh")
+	}
+
+	dir := t.TempDir()
+	gh_log := filepath.Join(dir, "gh.log")
+	writeTestFile(t, filepath.Join(dir, "gh"), "#!/bin/sh\necho \"$*\" >> '"+gh_log+"'\n"+script, 0755)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return gh_log
+}
+
+func TestRunGhTimeout(t *testing.T) {
+	defer func(timeout time.Duration, count int, delay time.Duration) {
+		ghTimeout = timeout
+		retryCount = count
+		retryBaseDelay = delay
+	}(ghTimeout, retryCount, retryBaseDelay)
+	ghTimeout = 100 * time.Millisecond
+	retryBaseDelay = time.Millisecond
+
+	tests := []struct {
+		name    string
+		retries int
+	}{
+		{name: "no retries", retries: 0},
+		{name: "retried", retries: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gh_log := fakeGh(t, "exec sleep 10\n")
+			retryCount = test.retries
+
+			start := time.Now()
+			_, err := runGh("pr", "list")
+			if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+				t.Fatalf("runGh() = %v, want a timeout", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("runGh() returned after %s, want it killed after ghTimeout", elapsed)
+			}
+			if calls := strings.Count(readGhLog(t, gh_log), "\n"); calls != test.retries+1 {
+				t.Errorf("runGh() ran gh %d times, want %d", calls, test.retries+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Base URL of the GitHub REST and GraphQL APIs
+var githubApiUrl = "https://api.github.com"
+
+// githubApiPrClient implements PrClient with the GitHub API directly, so the
+// gh CLI isn't needed for syncing. See ghFeatures for what still runs gh.
+type githubApiPrClient struct {
+	token  string
+	client *http.Client
+}
+
+func newGithubApiPrClient(token string) *githubApiPrClient {
+	return &githubApiPrClient{
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// githubApiError is a non 2xx response of the GitHub API.
+type githubApiError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string `json:"message"`
+	// Rate limit headers of the response, RateLimitRemaining is empty without
+	// them
+	RateLimitRemaining string
+	RateLimitReset     time.Time
+	RetryAfter         time.Duration
+}
+
+func (e *githubApiError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// do sends body as JSON to the API path and decodes the JSON response into
+// result unless it's nil. Transient failures are retried.
+func (a *githubApiPrClient) do(method string, path string, body any, result any) error {
+	return withRetries(method+" "+path, func() error {
+		return a.doOnce(method, path, body, result)
+	})
+}
+
+func (a *githubApiPrClient) doOnce(method string, path string, body any, result any) error {
+	var req_body io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		req_body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(runCtx, method, githubApiUrl+path, req_body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	err = ghDispatcher.acquire()
+	if err != nil {
+		return err
+	}
+	res, err := a.client.Do(req)
+	ghDispatcher.release()
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	res_body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		api_err := &githubApiError{Method: method, Path: path, StatusCode: res.StatusCode}
+		json.Unmarshal(res_body, api_err)
+		parseRateLimitHeaders(api_err, res.Header)
+		return api_err
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(res_body, result)
+}
+
+type githubApiPr struct {
+	Number  int    `json:"number"`
+	NodeId  string `json:"node_id"`
+	Title   string `json:"title"`
+	HtmlUrl string `json:"html_url"`
+	User    struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Head struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
+func (a *githubApiPrClient) FindPr(repo string, branch string, title string, author string) (*int, error) {
+	for page := 1; ; page++ {
+		var prs []githubApiPr
+		err := a.do(
+			http.MethodGet,
+			fmt.Sprintf("/repos/%s/pulls?state=open&per_page=100&page=%d", orgRepo(repo), page),
+			nil, &prs,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pr := range prs {
+			if pr.User.Login == author && pr.Title == title && pr.Head.Ref == branch {
+				return &pr.Number, nil
+			}
+		}
+
+		if len(prs) < 100 {
+			return nil, nil
+		}
+	}
+}
+
+// prForBranch returns the open PR from branch, or nil if there isn't one.
+func (a *githubApiPrClient) prForBranch(repo string, branch string) (*githubApiPr, error) {
+	var prs []githubApiPr
+	err := a.do(
+		http.MethodGet,
+		fmt.Sprintf("/repos/%s/pulls?state=open&head=%s", orgRepo(repo), url.QueryEscape(githubOrg+":"+branch)),
+		nil, &prs,
+	)
+	if err != nil || len(prs) == 0 {
+		return nil, err
+	}
+	return &prs[0], nil
+}
+
+func (a *githubApiPrClient) CreatePr(repo string, branch string, base string, title string, body string) (int, string, error) {
+	var pr githubApiPr
+	err := a.do(
+		http.MethodPost,
+		fmt.Sprintf("/repos/%s/pulls", orgRepo(repo)),
+		map[string]string{"title": title, "body": body, "head": branch, "base": base},
+		&pr,
+	)
+	if api_err, ok := err.(*githubApiError); ok && api_err.StatusCode == http.StatusUnprocessableEntity {
+		// An open PR from branch that FindPr didn't match, e.g. because its
+		// title was changed
+		existing, find_err := a.prForBranch(repo, branch)
+		if find_err == nil && existing != nil {
+			logInfo("Reusing existing PR %s", existing.HtmlUrl)
+			return existing.Number, existing.HtmlUrl, nil
+		}
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	logInfo("%s", pr.HtmlUrl)
+	return pr.Number, pr.HtmlUrl, nil
+}
+
+func (a *githubApiPrClient) EnableAutoMerge(repo string, branch string) error {
+	pr, err := a.prForBranch(repo, branch)
+	if err != nil {
+		return err
+	}
+	if pr == nil {
+		return fmt.Errorf("no open PR from %s in %s", branch, repo)
+	}
+
+	var result struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	err = a.do(http.MethodPost, "/graphql", map[string]any{
+		"query": `mutation($id: ID!) {
+			enablePullRequestAutoMerge(input: {pullRequestId: $id}) {
+				clientMutationId
+			}
+		}`,
+		"variables": map[string]string{"id": pr.NodeId},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("enabling auto merge of %s#%d: %s", repo, pr.Number, result.Errors[0].Message)
+	}
+	return nil
+}
+
+func (a *githubApiPrClient) RequestReviewers(repo string, pr_num int, reviewers []string) error {
+	users := []string{}
+	teams := []string{}
+	for _, reviewer := range reviewers {
+		// Teams are given as org/team like with gh
+		if _, team, ok := strings.Cut(reviewer, "/"); ok {
+			teams = append(teams, team)
+		} else {
+			users = append(users, reviewer)
+		}
+	}
+
+	return a.do(
+		http.MethodPost,
+		fmt.Sprintf("/repos/%s/pulls/%d/requested_reviewers", orgRepo(repo), pr_num),
+		map[string][]string{"reviewers": users, "team_reviewers": teams},
+		nil,
+	)
+}
+
+func (a *githubApiPrClient) AddLabel(repo string, pr_num int, label string) error {
+	// Unlike gh, the issues API would create a missing label
+	err := a.do(
+		http.MethodGet,
+		fmt.Sprintf("/repos/%s/labels/%s", orgRepo(repo), url.PathEscape(label)),
+		nil, nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	return a.do(
+		http.MethodPost,
+		fmt.Sprintf("/repos/%s/issues/%d/labels", orgRepo(repo), pr_num),
+		map[string][]string{"labels": {label}},
+		nil,
+	)
+}
+
+func (a *githubApiPrClient) AddAssignees(repo string, pr_num int, assignees []string) error {
+	return a.do(
+		http.MethodPost,
+		fmt.Sprintf("/repos/%s/issues/%d/assignees", orgRepo(repo), pr_num),
+		map[string][]string{"assignees": assignees},
+		nil,
+	)
+}
+
+func (a *githubApiPrClient) ViewPrBody(repo string, pr_num int) (string, error) {
+	var pr struct {
+		Body string `json:"body"`
+	}
+	err := a.do(
+		http.MethodGet,
+		fmt.Sprintf("/repos/%s/pulls/%d", orgRepo(repo), pr_num),
+		nil, &pr,
+	)
+	return pr.Body, err
+}
+
+func (a *githubApiPrClient) ViewPrUrl(repo string, pr_num int) (string, error) {
+	var pr githubApiPr
+	err := a.do(
+		http.MethodGet,
+		fmt.Sprintf("/repos/%s/pulls/%d", orgRepo(repo), pr_num),
+		nil, &pr,
+	)
+	return pr.HtmlUrl, err
+}
+
+func (a *githubApiPrClient) EditPrBody(repo string, pr_num int, body string) error {
+	return a.do(
+		http.MethodPatch,
+		fmt.Sprintf("/repos/%s/pulls/%d", orgRepo(repo), pr_num),
+		map[string]string{"body": body},
+		nil,
+	)
+}
+
+func (a *githubApiPrClient) UnresolvedReviewThreads(repo string, pr_num int) (int, error) {
+	var output json.RawMessage
+	err := a.do(http.MethodPost, "/graphql", map[string]any{
+		"query":     reviewThreadsQuery,
+		"variables": map[string]any{"owner": githubOrg, "name": repo, "number": pr_num},
+	}, &output)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	err = json.Unmarshal(output, &result)
+	if err != nil {
+		return 0, err
+	}
+	if len(result.Errors) > 0 {
+		return 0, errors.New(result.Errors[0].Message)
+	}
+	return parseUnresolvedReviewThreads(output)
+}
+
+func (a *githubApiPrClient) ViewRepo(repo string) (repoView, error) {
+	var view struct {
+		Archived      bool   `json:"archived"`
+		Disabled      bool   `json:"disabled"`
+		DefaultBranch string `json:"default_branch"`
+	}
+	err := a.do(http.MethodGet, "/repos/"+orgRepo(repo), nil, &view)
+	return repoView{
+		Archived:      view.Archived,
+		Disabled:      view.Disabled,
+		DefaultBranch: view.DefaultBranch,
+	}, err
+}
+
+// newPrClient returns the PR backend selected by pr_client: "gh", the
+// default, or "api" which needs GH_TOKEN.
+func newPrClient(c *Config) (PrClient, error) {
+	switch c.PrClient {
+	case "", "gh":
+		return ghCliPrClient{}, nil
+	case "api":
+		token := os.Getenv("GH_TOKEN")
+		if token == "" {
+			token = os.Getenv("GITHUB_TOKEN")
+		}
+		if token == "" {
+			return nil, fmt.Errorf("pr_client api requires GH_TOKEN or GITHUB_TOKEN")
+		}
+		return newGithubApiPrClient(token), nil
+	}
+	return nil, fmt.Errorf("pr_client must be gh or api, got %q", c.PrClient)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGithubApiViewRepo(t *testing.T) {
+	tests := []struct {
+		name          string
+		response      string
+		want_inactive string
+		want_branch   string
+		want_err      bool
+	}{
+		{name: "active", response: `{"default_branch":"main"}`, want_branch: "main"},
+		{name: "archived", response: `{"archived":true,"default_branch":"main"}`, want_inactive: "archived", want_branch: "main"},
+		{name: "disabled", response: `{"disabled":true,"default_branch":"dev"}`, want_inactive: "disabled", want_branch: "dev"},
+		{name: "no default branch", response: `{}`, want_err: true},
+	}
+
+	defer func(api_url string, client PrClient) {
+		githubApiUrl = api_url
+		prClient = client
+	}(githubApiUrl, prClient)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/"+orgRepo("alpha") {
+					http.NotFound(w, r)
+					return
+				}
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("request authorization = %q", r.Header.Get("Authorization"))
+				}
+				w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+			githubApiUrl = server.URL
+			prClient = newGithubApiPrClient("token")
+
+			inactive, err := inactiveReason("alpha")
+			if err != nil {
+				t.Fatalf("inactiveReason() failed: %v", err)
+			}
+			if inactive != test.want_inactive {
+				t.Errorf("inactiveReason() = %q, want %q", inactive, test.want_inactive)
+			}
+
+			branch, err := baseBranch(&Config{}, "alpha")
+			if test.want_err {
+				if err == nil {
+					t.Fatalf("baseBranch() = %q, want an error", branch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("baseBranch() failed: %v", err)
+			}
+			if branch != test.want_branch {
+				t.Errorf("baseBranch() = %q, want %q", branch, test.want_branch)
+			}
+		})
+	}
+}
+
+func TestGithubApiUnresolvedReviewThreads(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     int
+		want_err bool
+	}{
+		{
+			name:     "some unresolved",
+			response: `{"data":{"repository":{"pullRequest":{"reviewThreads":{"nodes":[{"isResolved":false},{"isResolved":true},{"isResolved":false}]}}}}}`,
+			want:     2,
+		},
+		{name: "no threads", response: `{"data":{"repository":{"pullRequest":{"reviewThreads":{"nodes":[]}}}}}`, want: 0},
+		{name: "graphql error", response: `{"data":null,"errors":[{"message":"Could not resolve to a PullRequest"}]}`, want_err: true},
+	}
+
+	defer func(api_url string) { githubApiUrl = api_url }(githubApiUrl)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Variables map[string]any `json:"variables"`
+				}
+				err := json.NewDecoder(r.Body).Decode(&req)
+				if err != nil || r.URL.Path != "/graphql" {
+					t.Errorf("unexpected request %s %s: %v", r.Method, r.URL.Path, err)
+				}
+				if req.Variables["name"] != "alpha" || req.Variables["number"] != float64(3) {
+					t.Errorf("query variables = %v", req.Variables)
+				}
+				w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+			githubApiUrl = server.URL
+
+			got, err := newGithubApiPrClient("token").UnresolvedReviewThreads("alpha", 3)
+			if test.want_err {
+				if err == nil {
+					t.Fatalf("UnresolvedReviewThreads() = %d, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnresolvedReviewThreads() failed: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("UnresolvedReviewThreads() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// matchGlob reports whether the slash separated name matches pattern. In
+// addition to the syntax supported by path.Match a "**" path segment matches
+// zero or more path segments. Malformed patterns never match.
+func matchGlob(pattern string, name string) bool {
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		matched, err := path.Match(pattern[0], name[0])
+		if err != nil || !matched {
+			return false
+		}
+
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// matchAnyGlob reports whether name matches at least one of patterns.
+func matchAnyGlob(patterns []string, name string) bool {
+	_, ok := firstMatchingGlob(patterns, name)
+	return ok
+}
+
+// firstMatchingGlob returns the first of patterns name matches.
+func firstMatchingGlob(patterns []string, name string) (string, bool) {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
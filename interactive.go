@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Reader of the answers to the -interactive prompts, shared by all repos so
+// input buffered while prompting for one isn't lost for the next.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// selectFiles lets the user toggle files on and off by their number until an
+// empty line is entered. All files start selected.
+func selectFiles(in *bufio.Reader, out io.Writer, files []string) (map[string]bool, error) {
+	selected := map[string]bool{}
+	for _, file := range files {
+		selected[file] = true
+	}
+
+	for {
+		for i, file := range files {
+			mark := " "
+			if selected[file] {
+				mark = "x"
+			}
+			fmt.Fprintf(out, "  %d [%s] %s\n", i+1, mark, file)
+		}
+		fmt.Fprint(out, "Toggle files by number (empty line to continue): ")
+
+		line, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return selected, nil
+		}
+
+		for _, field := range fields {
+			num, num_err := strconv.Atoi(field)
+			if num_err != nil || num < 1 || num > len(files) {
+				fmt.Fprintf(out, "Invalid file number %q\n", field)
+				continue
+			}
+			selected[files[num-1]] = !selected[files[num-1]]
+		}
+
+		if err == io.EOF {
+			return selected, nil
+		}
+	}
+}
+
+// applySelection drops the files that weren't selected from files_diff
+func applySelection(files_diff *FilesDiff, selected map[string]bool) {
+	keep := func(file_rel string) (bool, error) {
+		return selected[file_rel], nil
+	}
+	files_diff.NewFiles, _ = filterFiles(files_diff.NewFiles, keep)
+	files_diff.ChangedFiles, _ = filterFiles(files_diff.ChangedFiles, keep)
+	files_diff.DeletedFiles, _ = filterFiles(files_diff.DeletedFiles, keep)
+}
+
+// askApproval asks whether to sync repo_name until y, n or s to select the
+// files is answered. Anything but y or s at the end of input counts as no.
+func askApproval(in *bufio.Reader, out io.Writer, repo_name string) (string, error) {
+	for {
+		fmt.Fprintf(out, "Sync %s? [y]es, [n]o, [s]elect files: ", repo_name)
+
+		line, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		answer := strings.ToLower(strings.TrimSpace(line))
+		switch answer {
+		case "y", "yes":
+			return "y", nil
+		case "n", "no":
+			return "n", nil
+		case "s", "select":
+			return "s", nil
+		}
+
+		if err == io.EOF {
+			return "n", nil
+		}
+		fmt.Fprintf(out, "Invalid answer %q\n", answer)
+	}
+}
+
+// interactiveReview shows the changes files_diff makes to repo_name and asks
+// whether to sync them, optionally only some of the files. Reports false
+// when the repo should be skipped.
+func interactiveReview(repo_name, repo_dir string, files_diff *FilesDiff) (bool, error) {
+	diffs, err := prBodyDiffs(repo_dir, files_diff)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("Changes for %s:\n", repo_name)
+	for _, file := range files_diff.NewFiles {
+		fmt.Printf("  new     %s\n", file)
+	}
+	for _, file := range files_diff.ChangedFiles {
+		fmt.Printf("  changed %s\n", file)
+	}
+	for _, file := range files_diff.DeletedFiles {
+		fmt.Printf("  deleted %s\n", file)
+	}
+	for _, diff := range diffs {
+		fmt.Printf("--- %s\n%s\n", diff.File, diff.Content)
+	}
+
+	answer, err := askApproval(stdinReader, os.Stdout, repo_name)
+	if err != nil || answer == "n" {
+		return false, err
+	}
+	if answer == "y" {
+		return true, nil
+	}
+
+	selected, err := selectFiles(stdinReader, os.Stdout, diffPaths(files_diff))
+	if err != nil {
+		return false, err
+	}
+
+	applySelection(files_diff, selected)
+	return true, nil
+}
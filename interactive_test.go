@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSelectFiles(t *testing.T) {
+	files := []string{"a.txt", "b.txt", "c.txt"}
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{name: "keep all", input: "\n", want: []string{"a.txt", "b.txt", "c.txt"}},
+		{name: "end of input", input: "", want: []string{"a.txt", "b.txt", "c.txt"}},
+		{name: "drop one", input: "2\n\n", want: []string{"a.txt", "c.txt"}},
+		{name: "drop several", input: "1 3\n\n", want: []string{"b.txt"}},
+		{name: "toggle back", input: "1\n1\n\n", want: []string{"a.txt", "b.txt", "c.txt"}},
+		{name: "invalid numbers", input: "0 4 x 2\n\n", want: []string{"a.txt", "c.txt"}},
+		{name: "no trailing newline", input: "3", want: []string{"a.txt", "b.txt"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := selectFiles(bufio.NewReader(strings.NewReader(test.input)), io.Discard, files)
+			if err != nil {
+				t.Fatalf("selectFiles() failed: %v", err)
+			}
+
+			var got []string
+			for _, file := range files {
+				if selected[file] {
+					got = append(got, file)
+				}
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("selectFiles(%q) selected %v, want %v", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplySelection(t *testing.T) {
+	files_diff := &FilesDiff{
+		NewFiles:     []string{"new1", "new2"},
+		ChangedFiles: []string{"changed1", "changed2"},
+		DeletedFiles: []string{"deleted1", "deleted2"},
+	}
+	applySelection(files_diff, map[string]bool{"new2": true, "changed1": true, "deleted2": true, "other": true})
+
+	if !slices.Equal(files_diff.NewFiles, []string{"new2"}) {
+		t.Errorf("applySelection() kept new files %v, want [new2]", files_diff.NewFiles)
+	}
+	if !slices.Equal(files_diff.ChangedFiles, []string{"changed1"}) {
+		t.Errorf("applySelection() kept changed files %v, want [changed1]", files_diff.ChangedFiles)
+	}
+	if !slices.Equal(files_diff.DeletedFiles, []string{"deleted2"}) {
+		t.Errorf("applySelection() kept deleted files %v, want [deleted2]", files_diff.DeletedFiles)
+	}
+}
+
+func TestAskApproval(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "y\n", want: "y"},
+		{input: "YES\n", want: "y"},
+		{input: "n\n", want: "n"},
+		{input: "s\n", want: "s"},
+		{input: "maybe\nselect\n", want: "s"},
+		{input: "maybe", want: "n"},
+		{input: "", want: "n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := askApproval(bufio.NewReader(strings.NewReader(test.input)), io.Discard, "alpha")
+			if err != nil {
+				t.Fatalf("askApproval() failed: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("askApproval(%q) = %q, want %q", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+// TestPromptsShareInput checks that answers for several repos given at once
+// reach each prompt.
+func TestPromptsShareInput(t *testing.T) {
+	in := bufio.NewReader(strings.NewReader("s\n1\n\ny\n"))
+
+	answer, err := askApproval(in, io.Discard, "alpha")
+	if err != nil || answer != "s" {
+		t.Fatalf("askApproval(alpha) = %q, %v, want s", answer, err)
+	}
+	selected, err := selectFiles(in, io.Discard, []string{"a.txt", "b.txt"})
+	if err != nil || selected["a.txt"] || !selected["b.txt"] {
+		t.Fatalf("selectFiles(alpha) = %v, %v, want only b.txt", selected, err)
+	}
+	answer, err = askApproval(in, io.Discard, "beta")
+	if err != nil || answer != "y" {
+		t.Fatalf("askApproval(beta) = %q, %v, want y", answer, err)
+	}
+}
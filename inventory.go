@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InventoryRepo is a single repo returned by the repos_url inventory. The
+// response is either JSON or YAML of the form:
+//
+//	repos:
+//	  - name: ecsact_runtime
+//	    owner: ecsact-dev
+//	    default_branch: main
+//	    tier: core
+type InventoryRepo struct {
+	Name          string `yaml:"name"`
+	Owner         string `yaml:"owner"`
+	DefaultBranch string `yaml:"default_branch"`
+	Tier          string `yaml:"tier"`
+}
+
+type inventoryResponse struct {
+	Repos []InventoryRepo `yaml:"repos"`
+}
+
+var inventoryCache = struct {
+	sync.Mutex
+	responses map[string][]InventoryRepo
+}{responses: map[string][]InventoryRepo{}}
+
+func parseInventory(body []byte) ([]InventoryRepo, error) {
+	var response inventoryResponse
+	err := yaml.Unmarshal(body, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, repo := range response.Repos {
+		if repo.Name == "" {
+			return nil, fmt.Errorf("repo %d has no name", i)
+		}
+	}
+
+	return response.Repos, nil
+}
+
+// fetchInventory fetches the repo inventory at url. Responses are cached for
+// the rest of the run.
+func fetchInventory(url string) ([]InventoryRepo, error) {
+	inventoryCache.Lock()
+	defer inventoryCache.Unlock()
+
+	if repos, ok := inventoryCache.responses[url]; ok {
+		return repos, nil
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	repos, err := parseInventory(body)
+	if err != nil {
+		return nil, fmt.Errorf("inventory %s: %w", url, err)
+	}
+
+	inventoryCache.responses[url] = repos
+	return repos, nil
+}
+
+// inTiers reports whether repo_name has one of tiers in the repos_url
+// inventory.
+func inTiers(c *Config, repo_name string, tiers []string) bool {
+	repo, ok := c.Inventory[repo_name]
+	return ok && repo.Tier != "" && slices.Contains(tiers, repo.Tier)
+}
+
+// mergeInventory adds the inventory repos to c.Repos, skipping duplicates and
+// repos outside of the configured org, and records their metadata unless
+// already known from an earlier inventory.
+func mergeInventory(c *Config, repos []InventoryRepo) {
+	if c.Inventory == nil {
+		c.Inventory = map[string]InventoryRepo{}
+	}
+
+	for _, repo := range repos {
+		if repo.Owner != "" && repo.Owner != githubOrg {
+			logWarn("skipping inventory repo %s/%s, only %s repos are supported", repo.Owner, repo.Name, githubOrg)
+			continue
+		}
+
+		if _, known := c.Inventory[repo.Name]; !known {
+			c.Inventory[repo.Name] = repo
+		}
+		if !slices.Contains(c.Repos, repo.Name) {
+			c.Repos = append(c.Repos, repo.Name)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseInventory(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     []InventoryRepo
+		want_err bool
+	}{
+		{
+			name: "yaml",
+			body: "repos:\n  - name: ecsact_runtime\n    owner: ecsact-dev\n    default_branch: main\n    tier: core\n  - name: ecsact_cli\n",
+			want: []InventoryRepo{
+				{Name: "ecsact_runtime", Owner: "ecsact-dev", DefaultBranch: "main", Tier: "core"},
+				{Name: "ecsact_cli"},
+			},
+		},
+		{
+			name: "json",
+			body: `{"repos": [{"name": "ecsact_lang_cpp", "default_branch": "dev", "tier": "lang"}]}`,
+			want: []InventoryRepo{{Name: "ecsact_lang_cpp", DefaultBranch: "dev", Tier: "lang"}},
+		},
+		{name: "empty", body: `{"repos": []}`, want: []InventoryRepo{}},
+		{name: "missing name", body: "repos:\n  - tier: core\n", want_err: true},
+		{name: "invalid", body: "repos: [", want_err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseInventory([]byte(test.body))
+			if test.want_err {
+				if err == nil {
+					t.Fatalf("parseInventory() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseInventory() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseInventory() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFetchInventory(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/repos.yml":
+			w.Write([]byte("repos:\n  - name: ecsact_runtime\n    tier: core\n"))
+		default:
+			http.Error(w, "gone", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		repos, err := fetchInventory(server.URL + "/repos.yml")
+		if err != nil {
+			t.Fatalf("fetchInventory() failed: %v", err)
+		}
+		if len(repos) != 1 || repos[0].Name != "ecsact_runtime" || repos[0].Tier != "core" {
+			t.Errorf("fetchInventory() = %+v", repos)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("fetchInventory() sent %d requests, want the response cached after 1", requests)
+	}
+
+	_, err := fetchInventory(server.URL + "/missing.yml")
+	if err == nil {
+		t.Error("fetchInventory() of a 404 succeeded")
+	}
+}
+
+func TestMergeInventory(t *testing.T) {
+	c := &Config{Repos: []string{"ecsact_cli"}}
+	mergeInventory(c, []InventoryRepo{
+		{Name: "ecsact_cli", Tier: "tools"},
+		{Name: "ecsact_runtime", Owner: githubOrg, Tier: "core"},
+		{Name: "fork", Owner: "someone-else"},
+	})
+	// Metadata of an earlier inventory wins
+	mergeInventory(c, []InventoryRepo{{Name: "ecsact_runtime", Tier: "other"}})
+
+	if want := []string{"ecsact_cli", "ecsact_runtime"}; !slices.Equal(c.Repos, want) {
+		t.Errorf("mergeInventory() repos = %v, want %v", c.Repos, want)
+	}
+	if c.Inventory["ecsact_cli"].Tier != "tools" || c.Inventory["ecsact_runtime"].Tier != "core" {
+		t.Errorf("mergeInventory() metadata = %+v", c.Inventory)
+	}
+	if _, ok := c.Inventory["fork"]; ok {
+		t.Error("mergeInventory() recorded a repo of another owner")
+	}
+}
+
+// TestInventoryTiers checks that file_sets and sync_sets select repos by
+// their inventory tier.
+func TestInventoryTiers(t *testing.T) {
+	c := &Config{
+		FilesDir: "files",
+		Repos:    []string{"ecsact_cli"},
+		FileSets: []FileSet{
+			{Paths: []string{"runtime/"}, Tiers: []string{"core"}},
+			{Paths: []string{"cli.yml"}, Repos: []string{"ecsact_cli"}, Tiers: []string{"tools"}},
+		},
+		SyncSets: []SyncSet{
+			{Name: "core", Tiers: []string{"core"}},
+			{Name: "all"},
+		},
+	}
+	mergeInventory(c, []InventoryRepo{
+		{Name: "ecsact_runtime", Tier: "core"},
+		{Name: "ecsact_parse", Tier: "core"},
+		{Name: "ecsact_lsp", Tier: "tools"},
+		{Name: "ecsact_docs"},
+	})
+
+	files := []string{
+		filepath.Join("files", "runtime", "a.h"),
+		filepath.Join("files", "cli.yml"),
+		filepath.Join("files", "README.md"),
+	}
+	tests := []struct {
+		repo_name string
+		want      []string
+	}{
+		{repo_name: "ecsact_runtime", want: []string{files[0], files[2]}},
+		{repo_name: "ecsact_cli", want: []string{files[1], files[2]}},
+		{repo_name: "ecsact_lsp", want: []string{files[1], files[2]}},
+		{repo_name: "ecsact_docs", want: []string{files[2]}},
+	}
+	for _, test := range tests {
+		if got := filesForRepo(c, files, test.repo_name, nil); !slices.Equal(got, test.want) {
+			t.Errorf("filesForRepo(%s) = %v, want %v", test.repo_name, got, test.want)
+		}
+	}
+
+	sets, err := c.syncSetConfigs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ecsact_runtime", "ecsact_parse"}; !slices.Equal(sets[0].Repos, want) {
+		t.Errorf("sync set core repos = %v, want %v", sets[0].Repos, want)
+	}
+	if len(sets[1].Repos) != 5 {
+		t.Errorf("sync set all repos = %v, want every repo", sets[1].Repos)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+// Size from which managed files are compared by size and git blob hash before
+// falling back to a full content comparison, unless large_file_size is set.
+const defaultLargeFileSize = 1 << 20
+
+// Set in main() from large_file_size.
+var largeFileSize int64 = defaultLargeFileSize
+
+// readIndexEntries returns the git index entries of the clone in dir by path,
+// or nil if the index can't be read.
+func readIndexEntries(dir string) map[string]*index.Entry {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil
+	}
+
+	entries := make(map[string]*index.Entry, len(idx.Entries))
+	for _, entry := range idx.Entries {
+		entries[entry.Name] = entry
+	}
+	return entries
+}
+
+// blobHash returns the git blob hash of the source of m, cached like hash.
+func (m fileMapping) blobHash(stat os.FileInfo) (plumbing.Hash, error) {
+	key := hashCacheKey(m) + "\x00blob"
+	if hash, ok := hashCache.lookupKey(key, stat); ok {
+		return plumbing.NewHash(hash), nil
+	}
+
+	content, err := os.ReadFile(m.Source)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	hash := plumbing.ComputeHash(plumbing.BlobObject, content)
+	hashCache.storeKey(key, stat, hash.String())
+	return hash, nil
+}
+
+// largeFileEqual compares the large untransformed managed file m against
+// repo_file. When the size and mtime of repo_file show it's unchanged since
+// checkout, a blob hash recorded in the clone's index equal to that of m means
+// equal content. Otherwise both files are streamed, ignoring line ending
+// differences in text files like the comparison of smaller files does. ok is
+// false when m isn't large.
+func (fc *fileComparer) largeFileEqual(m fileMapping, repo_file string, src_stat os.FileInfo, repo_stat os.FileInfo) (equal bool, ok bool, err error) {
+	if src_stat.Size() < largeFileSize {
+		return false, false, nil
+	}
+
+	entry := fc.index[m.Dest]
+	if entry != nil && int64(entry.Size) == repo_stat.Size() && entry.ModifiedAt.Equal(repo_stat.ModTime()) {
+		hash, err := m.blobHash(src_stat)
+		if err != nil {
+			return false, false, err
+		}
+		if hash == entry.Hash {
+			return true, true, nil
+		}
+	}
+
+	equal, err = streamEqual(m.Source, repo_file, src_stat.Size() == repo_stat.Size())
+	if err != nil {
+		return false, false, err
+	}
+	return equal, true, nil
+}
+
+// streamEqual compares the files a and b without reading them into memory.
+// Text files are equal if they only differ in line endings, binary files,
+// detected like isBinary does, only if same_size and their bytes match.
+func streamEqual(a string, b string, same_size bool) (bool, error) {
+	a_file, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer a_file.Close()
+	b_file, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer b_file.Close()
+
+	a_reader := bufio.NewReaderSize(a_file, 64<<10)
+	b_reader := bufio.NewReaderSize(b_file, 64<<10)
+
+	// Peek only fails short of 8000 bytes at the end of the file
+	a_head, _ := a_reader.Peek(8000)
+	b_head, _ := b_reader.Peek(8000)
+	text := !isBinary(a_head) && !isBinary(b_head)
+	if !text && !same_size {
+		return false, nil
+	}
+
+	a_bytes := &eolReader{r: a_reader, normalize: text}
+	b_bytes := &eolReader{r: b_reader, normalize: text}
+	for {
+		a_byte, a_err := a_bytes.ReadByte()
+		b_byte, b_err := b_bytes.ReadByte()
+		if a_err == io.EOF || b_err == io.EOF {
+			return a_err == b_err, nil
+		}
+		if a_err != nil {
+			return false, a_err
+		}
+		if b_err != nil {
+			return false, b_err
+		}
+		if a_byte != b_byte {
+			return false, nil
+		}
+	}
+}
+
+// eolReader reads the bytes of r, with every "\r\n" turned into "\n" when
+// normalize is set.
+type eolReader struct {
+	r         *bufio.Reader
+	normalize bool
+}
+
+func (e *eolReader) ReadByte() (byte, error) {
+	c, err := e.r.ReadByte()
+	if err != nil || c != '\r' || !e.normalize {
+		return c, err
+	}
+
+	next, err := e.r.Peek(1)
+	if err == nil && next[0] == '\n' {
+		return e.r.ReadByte()
+	}
+	return c, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestLargeFileDifferences checks that files above large_file_size count as
+// changed exactly when smaller ones with the same content would.
+func TestLargeFileDifferences(t *testing.T) {
+	text := strings.Repeat("some line of text\n", 100)
+	binary := "\x00" + strings.Repeat("b", 1000)
+
+	tests := []struct {
+		name   string
+		source string
+		repo   string
+		want   bool
+	}{
+		{name: "equal", source: text, repo: text, want: false},
+		{name: "crlf in repo", source: text, repo: strings.ReplaceAll(text, "\n", "\r\n"), want: false},
+		{name: "crlf in source", source: strings.ReplaceAll(text, "\n", "\r\n"), repo: text, want: false},
+		{name: "lone cr", source: text, repo: strings.Replace(text, "\n", "\r", 1), want: true},
+		{name: "changed text", source: text, repo: strings.Replace(text, "some", "same", 1), want: true},
+		{name: "longer text", source: text, repo: text + "more\n", want: true},
+		{name: "equal binary", source: binary, repo: binary, want: false},
+		{name: "changed binary", source: binary, repo: binary[:999] + "c", want: true},
+		{name: "crlf binary", source: binary + "\n", repo: binary + "\r\n", want: true},
+	}
+
+	for _, large := range []bool{false, true} {
+		for _, test := range tests {
+			name := test.name
+			if large {
+				name += " large"
+			}
+			t.Run(name, func(t *testing.T) {
+				defer func(size int64) { largeFileSize = size }(largeFileSize)
+				largeFileSize = defaultLargeFileSize
+				if large {
+					largeFileSize = 100
+				}
+
+				dir := t.TempDir()
+				source := filepath.Join(dir, "source.txt")
+				repo_file := filepath.Join(dir, "repo.txt")
+				err := os.WriteFile(source, []byte(test.source), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(repo_file, []byte(test.repo), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				fc := &fileComparer{detect: changeDetect{Content: true}}
+				diffs, err := fc.differences(fileMapping{Source: source, Dest: "repo.txt"}, repo_file)
+				if err != nil {
+					t.Fatalf("differences() failed: %v", err)
+				}
+				if got := slices.Contains(diffs, "content"); got != test.want {
+					t.Errorf("differences() = %v, want a content change %v", diffs, test.want)
+				}
+			})
+		}
+	}
+}
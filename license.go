@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// Distinctive phrases used to identify common licenses. Checked in order so
+// more specific licenses must come before ones whose text they contain.
+var licenseSignatures = []struct {
+	Id      string
+	Phrases []string
+}{
+	{"LGPL-3.0", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"LGPL-2.1", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 2.1"}},
+	{"AGPL-3.0", []string{"GNU AFFERO GENERAL PUBLIC LICENSE"}},
+	{"GPL-3.0", []string{"GNU GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"GPL-2.0", []string{"GNU GENERAL PUBLIC LICENSE", "Version 2"}},
+	{"Apache-2.0", []string{"Apache License", "Version 2.0"}},
+	{"MPL-2.0", []string{"Mozilla Public License Version 2.0"}},
+	{"BSD-3-Clause", []string{"Redistribution and use in source and binary forms", "Neither the name"}},
+	{"BSD-2-Clause", []string{"Redistribution and use in source and binary forms"}},
+	{"MIT", []string{"Permission is hereby granted, free of charge"}},
+	{"Unlicense", []string{"This is free and unencumbered software"}},
+}
+
+func isLicenseFile(file_rel string) bool {
+	return strings.HasPrefix(strings.ToUpper(path.Base(file_rel)), "LICENSE")
+}
+
+// detectLicense returns the identifier of the license in content or an empty
+// string if it isn't recognized.
+func detectLicense(content string) string {
+	for _, signature := range licenseSignatures {
+		matched := true
+		for _, phrase := range signature.Phrases {
+			if !strings.Contains(content, phrase) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return signature.Id
+		}
+	}
+	return ""
+}
+
+// findRepoLicense finds the license file already present in the repo for the
+// managed license file_rel. The file at the same path is preferred, otherwise
+// any other license file in the same directory is used.
+func findRepoLicense(repo_dir string, file_rel string) (string, error) {
+	dir := path.Dir(file_rel)
+	candidates := []string{file_rel}
+
+	entries, err := os.ReadDir(repo_dir + "/" + dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && isLicenseFile(entry.Name()) {
+			candidates = append(candidates, path.Join(dir, entry.Name()))
+		}
+	}
+
+	for _, candidate := range candidates {
+		content, err := os.ReadFile(repo_dir + "/" + candidate)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(content), nil
+	}
+
+	return "", nil
+}
+
+// filterLicenseChanges removes managed license files from files_diff when the
+// repo already has a recognizably different license, since that is most
+// likely intentional.
+func filterLicenseChanges(
+	repo_dir string,
+	files_diff *FilesDiff,
+	trace *fileTrace,
+) error {
+	keep := func(file_rel string) (bool, error) {
+		if !isLicenseFile(file_rel) {
+			return true, nil
+		}
+
+		managed, err := files_diff.Mappings[file_rel].render()
+		if err != nil {
+			return false, err
+		}
+
+		existing, err := findRepoLicense(repo_dir, file_rel)
+		if err != nil {
+			return false, err
+		}
+
+		managed_id := detectLicense(string(managed))
+		existing_id := detectLicense(existing)
+		if managed_id == "" || existing_id == "" || managed_id == existing_id {
+			trace.add(file_rel, "license check passed (managed %q, repo %q)", managed_id, existing_id)
+			return true, nil
+		}
+
+		trace.add(file_rel, "license check failed (managed %q, repo %q)", managed_id, existing_id)
+		trace.decide(file_rel, "skip (repo has a different license)")
+
+		logWarn(
+			"skipping %s, repo is licensed %s but managed license is %s (use -allow-license-change to override)",
+			file_rel, existing_id, managed_id,
+		)
+		return false, nil
+	}
+
+	var err error
+	files_diff.NewFiles, err = filterFiles(files_diff.NewFiles, keep)
+	if err != nil {
+		return err
+	}
+	files_diff.ChangedFiles, err = filterFiles(files_diff.ChangedFiles, keep)
+	return err
+}
+
+func filterFiles(files []string, keep func(string) (bool, error)) ([]string, error) {
+	var result []string
+	for _, file := range files {
+		ok, err := keep(file)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, file)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const (
+	testMitLicense    = "MIT License\n\nPermission is hereby granted, free of charge, to any person obtaining a copy\n"
+	testApacheLicense = "                                 Apache License\n                           Version 2.0, January 2004\n"
+)
+
+func TestDetectLicense(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "mit", content: testMitLicense, want: "MIT"},
+		{name: "apache", content: testApacheLicense, want: "Apache-2.0"},
+		{name: "lgpl before gpl", content: "GNU LESSER GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007\n", want: "LGPL-3.0"},
+		{name: "gpl 2", content: "GNU GENERAL PUBLIC LICENSE\nVersion 2, June 1991\n", want: "GPL-2.0"},
+		{
+			name:    "bsd 3 before bsd 2",
+			content: "Redistribution and use in source and binary forms, with or without\n3. Neither the name of the copyright holder\n",
+			want:    "BSD-3-Clause",
+		},
+		{name: "bsd 2", content: "Redistribution and use in source and binary forms, with or without\n", want: "BSD-2-Clause"},
+		{name: "unknown", content: "All rights reserved.\n", want: ""},
+		{name: "empty", content: "", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := detectLicense(test.content); got != test.want {
+				t.Errorf("detectLicense() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterLicenseChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		// Existing license files of the repo by path
+		repo_files map[string]string
+		want       []string
+	}{
+		{name: "no license yet", want: []string{"LICENSE", "README.md"}},
+		{name: "same license", repo_files: map[string]string{"LICENSE": testMitLicense + "Copyright 2020\n"}, want: []string{"LICENSE", "README.md"}},
+		{name: "different license", repo_files: map[string]string{"LICENSE": testApacheLicense}, want: []string{"README.md"}},
+		{name: "different license file name", repo_files: map[string]string{"LICENSE.txt": testApacheLicense}, want: []string{"README.md"}},
+		{name: "unrecognized license", repo_files: map[string]string{"LICENSE": "Proprietary\n"}, want: []string{"LICENSE", "README.md"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files_dir := filepath.Join(dir, "files")
+			repo_dir := filepath.Join(dir, "repo")
+			writeTestFile(t, filepath.Join(files_dir, "LICENSE"), testMitLicense, 0644)
+			writeTestFile(t, filepath.Join(files_dir, "README.md"), "# readme\n", 0644)
+			writeTestFile(t, filepath.Join(repo_dir, "README.md"), "old\n", 0644)
+			for file_rel, content := range test.repo_files {
+				writeTestFile(t, filepath.Join(repo_dir, file_rel), content, 0644)
+			}
+
+			files_diff := &FilesDiff{
+				Mappings: map[string]fileMapping{
+					"LICENSE":   {Source: filepath.Join(files_dir, "LICENSE"), Dest: "LICENSE"},
+					"README.md": {Source: filepath.Join(files_dir, "README.md"), Dest: "README.md"},
+				},
+			}
+			if _, ok := test.repo_files["LICENSE"]; ok {
+				files_diff.ChangedFiles = []string{"LICENSE", "README.md"}
+			} else {
+				files_diff.NewFiles = []string{"LICENSE"}
+				files_diff.ChangedFiles = []string{"README.md"}
+			}
+
+			err := filterLicenseChanges(repo_dir, files_diff, nil)
+			if err != nil {
+				t.Fatalf("filterLicenseChanges() failed: %v", err)
+			}
+			got := append(slices.Clone(files_diff.NewFiles), files_diff.ChangedFiles...)
+			slices.Sort(got)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("filterLicenseChanges() kept %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type logLevel int
+
+const (
+	// Only errors and the final summary
+	levelQuiet logLevel = iota
+	levelNormal
+	// Also every file written and every git and gh command run
+	levelVerbose
+)
+
+// Verbosity of the output, set from -q and -v in main().
+var verbosity = levelNormal
+
+func logAt(level logLevel, prefix string, format string, args []any) {
+	if verbosity < level {
+		return
+	}
+	fmt.Fprintf(os.Stdout, prefix+strings.TrimSuffix(format, "\n")+"\n", args...)
+}
+
+// logInfo prints a progress message, hidden by -q.
+func logInfo(format string, args ...any) {
+	logAt(levelNormal, "", format, args)
+}
+
+// logWarn prints a warning, hidden by -q.
+func logWarn(format string, args ...any) {
+	logAt(levelNormal, "WARNING: ", format, args)
+}
+
+// logError prints an error at every verbosity.
+func logError(format string, args ...any) {
+	logAt(levelQuiet, "ERROR: ", format, args)
+}
+
+// logVerbose prints a detail only shown with -v.
+func logVerbose(format string, args ...any) {
+	logAt(levelVerbose, "", format, args)
+}
+
+var urlCredentialsRegexp = regexp.MustCompile(`://[^/@\s]+@`)
+
+// logCommand logs a git or gh invocation with -v, redacting credentials in
+// URLs.
+func logCommand(name string, args []string) {
+	if verbosity < levelVerbose {
+		return
+	}
+	command := urlCredentialsRegexp.ReplaceAllString(strings.Join(args, " "), "://***@")
+	logVerbose("+ %s %s", name, command)
+}
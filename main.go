@@ -1,44 +1,246 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"runtime/debug"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/udhos/equalfile"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	PrTitle     string   `yaml:"pr_title"`
-	FilesDir    string   `yaml:"files_dir"`
-	AuthorLogin string   `yaml:"author_login"`
-	Repos       []string `yaml:"repos"`
+	PrTitle     string `yaml:"pr_title"`
+	FilesDir    string `yaml:"files_dir"`
+	AuthorLogin string `yaml:"author_login"`
+	// Name and email sync commits are authored and committed with, default to
+	// AuthorLogin and its GitHub noreply address
+	AuthorName      string           `yaml:"author_name"`
+	AuthorEmail     string           `yaml:"author_email"`
+	Org             string           `yaml:"org"`
+	RepoConfigs     []RepoConfig     `yaml:"repos"`
+	PrBodyFragments []PrBodyFragment `yaml:"pr_body_fragments"`
+	CheckLicense    bool             `yaml:"check_license"`
+	CommitTimezone  string           `yaml:"commit_timezone"`
+	RespectReviews  bool             `yaml:"respect_reviews"`
+	PrBodyDiffs     bool             `yaml:"pr_body_diffs"`
+	PrBodyMaxSize   int              `yaml:"pr_body_max_size"`
+	PrBodyChecksums bool             `yaml:"pr_body_checksums"`
+	// Destination in the repo of each managed file path relative to FilesDir,
+	// files without an entry keep their relative path
+	Mappings map[string]string `yaml:"mappings"`
+	// Line endings (lf or crlf) to write files matching each glob with
+	Eol        map[string]string `yaml:"eol"`
+	SecretScan SecretScanConfig  `yaml:"secret_scan"`
+	// Shell commands run in the clone after the synced files are written and
+	// before they're committed, e.g. a formatter
+	PostSyncCommands []string `yaml:"post_sync_commands"`
+	// Globs of generated files whose changes alone don't open a sync PR, in
+	// addition to the manifest and .ecsact-common/**
+	MetadataPaths []string `yaml:"metadata_paths"`
+	// Go template for the PR body, defaults to a link to ecsact_common
+	PrBody string `yaml:"pr_body"`
+	// Labels added to sync PRs, reviewers and assignees of created sync PRs
+	Labels    []string `yaml:"labels"`
+	Reviewers []string `yaml:"reviewers"`
+	Assignees []string `yaml:"assignees"`
+	// Go template for the sync commit message, defaults to PrTitle
+	CommitMessage string        `yaml:"commit_message"`
+	Signing       SigningConfig `yaml:"signing"`
+	// Append a Signed-off-by trailer for the commit author to commit messages
+	Signoff bool `yaml:"signoff"`
+	// Timeout of each gh invocation and retries of transient network failures
+	GhTimeout time.Duration `yaml:"gh_timeout"`
+	GhRetries *int          `yaml:"gh_retries"`
+	// Number of gh calls allowed to run at once, defaults to 1, and the minimum
+	// time between starting them
+	ApiConcurrency int           `yaml:"api_concurrency"`
+	ApiInterval    time.Duration `yaml:"api_interval"`
+	// Number of files compared and copied in parallel, defaults to the number
+	// of CPUs
+	FileWorkers int `yaml:"file_workers"`
+	// Size in bytes from which files are compared by git blob hash or
+	// streamed instead of read into memory, defaults to 1 MiB
+	LargeFileSize int64 `yaml:"large_file_size"`
+	// Globs of binary managed files, e.g. large assets, not synced at all
+	ExcludeBinary []string `yaml:"exclude_binary"`
+	// Globs relative to FilesDir of the files that are managed, all of them
+	// when empty, and of files that aren't. Exclude wins over Include. Files
+	// excluded after being synced are left in the repos.
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+	// URL of a repo inventory whose repos are synced in addition to Repos
+	ReposURL string `yaml:"repos_url"`
+	// GitHub topic whose non archived org repos are synced in addition to Repos
+	RepoTopic string `yaml:"repo_topic"`
+
+	FileSets []FileSet `yaml:"file_sets"`
+	// File attributes that count as a change: content, mode, eol and
+	// symlink-target. Defaults to content and mode.
+	ChangeDetect []string `yaml:"change_detect"`
+	// Normalizers used by -classify-changes to tell formatting only changes
+	// apart. Any of eol, trailing-whitespace, blank-lines or whitespace.
+	SoftChangeNormalizers []string `yaml:"soft_change_normalizers"`
+
+	// repository_dispatch event sent after each PR is created or updated
+	Dispatch DispatchConfig `yaml:"dispatch"`
+
+	// Branch sync PRs are opened from, {repo} is replaced by the repo name.
+	// Defaults to chore/sync-with-ecsact-common
+	BranchName string `yaml:"branch_name"`
+
+	// Independent groups of managed files each synced with their own PR,
+	// replacing the single set of files_dir and pr_title
+	SyncSets []SyncSet `yaml:"sync_sets"`
+
+	Dedupe DedupeConfig `yaml:"dedupe"`
+	Stale  StaleConfig  `yaml:"close_stale"`
+	// Keep the last synced content of each managed file in
+	// .ecsact-common/snapshots and don't overwrite repo files that changed since
+	// while the managed file changed too
+	Snapshots bool `yaml:"snapshots"`
+	// PR body and reviewers by the category most of the changed files fall in
+	ChangeCategories []ChangeCategory `yaml:"change_categories"`
+	// Backend for finding and creating PRs, gh (the default) or api to use the
+	// GitHub API with GH_TOKEN directly. Topic discovery, dispatch,
+	// -close-stale, -prune-branches and -dedupe-prs still need gh.
+	PrClient string `yaml:"pr_client"`
+	// Posts the details of each created or updated sync PR to a tracker
+	TrackerWebhook TrackerWebhookConfig `yaml:"tracker_webhook"`
+	// Command run in FilesDir printing the managed files, one path relative to
+	// FilesDir per line. Replaces walking FilesDir unless augmenting.
+	SourceCommand        []string `yaml:"source_command"`
+	SourceCommandAugment bool     `yaml:"source_command_augment"`
+	// Branch sync PRs target, per repo in BaseBranches. Defaults to the repo's
+	// default branch.
+	BaseBranch   string            `yaml:"base_branch"`
+	BaseBranches map[string]string `yaml:"base_branches"`
+	// URL repos are cloned from and pushed to with {repo} replaced by the repo
+	// name. Defaults to the repo on GitHub.
+	CloneUrl string `yaml:"clone_url"`
+
+	// Path globs of files that are expected to be managed, used by
+	// -report-unmanaged-candidates
+	ManagedPatterns []string `yaml:"managed_patterns"`
+
+	// Command run in each clone before comparing files. Repos where it exits
+	// nonzero aren't synced. RepoProbes overrides it per repo.
+	Probe      []string            `yaml:"probe"`
+	RepoProbes map[string][]string `yaml:"repo_probes"`
+
+	// Names of the repos to sync from RepoConfigs, the ReposURL inventory and
+	// RepoTopic
+	Repos []string `yaml:"-"`
+	// Metadata of repos from the ReposURL inventory and RepoTopic
+	Inventory map[string]InventoryRepo `yaml:"-"`
+	// Name of the sync set this config was derived from, empty without
+	// SyncSets
+	SetName string `yaml:"-"`
+}
+
+// PrBodyFragment is extra text appended to the PR body when any new or
+// changed file matches one of Paths.
+type PrBodyFragment struct {
+	Paths []string `yaml:"paths"`
+	Body  string   `yaml:"body"`
 }
 
 type FilesDiff struct {
 	NewFiles     []string
 	ChangedFiles []string
+	// Previously synced files that are no longer managed
+	DeletedFiles []string
+	// Mapping of each new and changed destination path
+	Mappings map[string]fileMapping
+	// Hex sha256 of the content written to each new and changed path
+	Hashes map[string]string
 }
 
 func checkErr(err error) {
 	if err != nil {
-		debug.PrintStack()
+		if verbosity >= levelVerbose {
+			debug.PrintStack()
+		}
 		log.Fatal(err)
 	}
 }
 
+// Validate checks that every required field is set, reporting all missing
+// fields at once.
+func (c *Config) Validate() error {
+	var problems []string
+	if c.PrTitle == "" && len(c.SyncSets) == 0 {
+		problems = append(problems, "pr_title is required")
+	}
+	if c.FilesDir == "" && len(c.SyncSets) == 0 {
+		problems = append(problems, "files_dir is required")
+	} else if c.FilesDir != "" {
+		problems = append(problems, checkFilesDir("files_dir", c.FilesDir)...)
+	}
+	if c.AuthorLogin == "" {
+		problems = append(problems, "author_login is required")
+	}
+	if len(c.Repos) == 0 && c.ReposURL == "" && c.RepoTopic == "" {
+		problems = append(problems, "repos, repos_url or repo_topic is required")
+	}
+	for i, repo := range c.RepoConfigs {
+		if repo.Name == "" {
+			problems = append(problems, fmt.Sprintf("repos[%d]: name is required", i))
+		}
+		if repo.DestPrefix != "" && !insideRepo(repo.DestPrefix) {
+			problems = append(problems, fmt.Sprintf("repos[%d]: dest_prefix must be a path inside the repo, got %q", i, repo.DestPrefix))
+		}
+	}
+	problems = append(problems, c.validateSyncSets()...)
+	for source_rel, dest_rel := range c.Mappings {
+		if !insideRepo(dest_rel) {
+			problems = append(problems, fmt.Sprintf("mappings: %q must map to a path inside the repo, got %q", source_rel, dest_rel))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// insideRepo reports whether the relative path file_rel stays inside the repo.
+func insideRepo(file_rel string) bool {
+	clean := path.Clean(file_rel)
+	return file_rel != "" && !path.IsAbs(clean) && clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// checkFilesDir reports a problem when files_dir isn't a directory.
+func checkFilesDir(field string, files_dir string) []string {
+	stat, err := os.Stat(files_dir)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %s", field, err)}
+	} else if !stat.IsDir() {
+		return []string{fmt.Sprintf("%s %s is not a directory", field, files_dir)}
+	}
+	return nil
+}
+
 func readConfig(filename string) (*Config, error) {
 	buf, err := os.ReadFile(filename)
 	if err != nil {
@@ -51,54 +253,338 @@ func readConfig(filename string) (*Config, error) {
 		return nil, fmt.Errorf("in file %q: %w", filename, err)
 	}
 
+	for _, repo := range c.RepoConfigs {
+		c.Repos = append(c.Repos, repo.Name)
+	}
+
+	// FilesDir is relative to the config file, not the working directory
+	if c.FilesDir != "" && !filepath.IsAbs(c.FilesDir) {
+		c.FilesDir = filepath.Join(filepath.Dir(filename), c.FilesDir)
+	}
+	c.resolveSyncSetDirs(filepath.Dir(filename))
+
 	return c, err
 }
 
-func getFilesDiff(dir string, files []string, strip_prefix string) (*FilesDiff, error) {
-	result := &FilesDiff{}
-	cmp := equalfile.NewMultiple(nil, equalfile.Options{}, sha256.New(), true)
+// Number of files hashed or copied concurrently within a single repo.
+var fileWorkers = runtime.NumCPU()
+
+// parallelEach calls fn for every index in [0, n) using at most workers
+// goroutines. fn also receives the index of the worker running it so callers
+// can keep per-worker state. Errors from every call are joined together.
+func parallelEach(n int, workers int, fn func(worker int, i int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	errs := make([]error, n)
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := range indices {
+				errs[i] = fn(worker, i)
+			}
+		}(w)
+	}
+
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
 
-	for _, file := range files {
-		file_rel := strings.TrimPrefix(strings.ReplaceAll(file, "\\", "/"), strip_prefix)
+func getFilesDiff(
+	dir string,
+	manifest map[string]repoManifestFile,
+	mappings []fileMapping,
+	exclude []string,
+	detect changeDetect,
+	trace *fileTrace,
+) (*FilesDiff, error) {
+	result := &FilesDiff{
+		Mappings: map[string]fileMapping{},
+		Hashes:   map[string]string{},
+	}
+
+	// equalfile.Cmp keeps an internal hash table and buffer so each worker
+	// needs its own
+	index_entries := readIndexEntries(dir)
+	comparers := make([]*fileComparer, fileWorkers)
+	for i := range comparers {
+		comparers[i] = &fileComparer{
+			detect:   detect,
+			cmp:      equalfile.NewMultiple(nil, equalfile.Options{}, sha256.New(), true),
+			index:    index_entries,
+			manifest: manifest,
+		}
+	}
+
+	var mu sync.Mutex
+	err := parallelEach(len(mappings), fileWorkers, func(worker int, i int) error {
+		file := mappings[i].Source
+		file_rel := mappings[i].Dest
 		repo_file := dir + "/" + file_rel
 
 		stat, err := os.Stat(file)
-		checkErr(err)
+		if err != nil {
+			return err
+		}
 
 		if stat.IsDir() {
-			continue
+			return nil
 		}
 
-		stat, err = os.Stat(repo_file)
+		_, err = os.Lstat(repo_file)
 		if err != nil && !os.IsNotExist(err) {
-			log.Fatal(err)
+			return err
 		} else if os.IsNotExist(err) {
+			trace.add(file_rel, "not present in repo")
+			trace.decide(file_rel, "sync (new)")
+
+			hash, err := mappings[i].hash()
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
 			result.NewFiles = append(result.NewFiles, file_rel)
+			result.Mappings[file_rel] = mappings[i]
+			result.Hashes[file_rel] = hash
+			mu.Unlock()
 		} else {
-			equal, err := cmp.CompareFile(repo_file, file)
+			mapping := mappings[i]
+			block, err := hasManagedBlock(mapping.Source)
+			if err != nil {
+				return err
+			}
+			if block {
+				trace.add(file_rel, "only the managed block is synced")
+				mapping.BlockTarget = repo_file
+			}
+
+			diffs, err := comparers[worker].differences(mapping, repo_file)
 			if err != nil {
-				return nil, err
+				return fmt.Errorf("comparing %q: %w", file_rel, err)
 			}
 
-			if !equal {
+			if len(diffs) > 0 {
+				trace.add(file_rel, "differs from repo: %s", strings.Join(diffs, ", "))
+				trace.decide(file_rel, "sync (changed)")
+
+				hash, err := mapping.hash()
+				if err != nil {
+					return err
+				}
+
+				mu.Lock()
 				result.ChangedFiles = append(result.ChangedFiles, file_rel)
+				result.Mappings[file_rel] = mapping
+				result.Hashes[file_rel] = hash
+				mu.Unlock()
+			} else {
+				trace.add(file_rel, "equal to repo")
+				trace.decide(file_rel, "skip (unchanged)")
 			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(result.NewFiles)
+	sort.Strings(result.ChangedFiles)
+
+	result.DeletedFiles, err = deletedFiles(dir, manifest, mappings, exclude)
+	if err != nil {
+		return nil, err
+	}
+	for _, file_rel := range result.DeletedFiles {
+		trace.add(file_rel, "previously synced but no longer managed")
+		trace.decide(file_rel, "delete")
 	}
 
 	return result, nil
 }
 
-func getAllFiles(dir string) ([]string, error) {
+// copyFiles copies each of files (destination paths) from their source in
+// files_diff into dst_dir concurrently.
+func copyFiles(files_diff *FilesDiff, dst_dir string, files []string) error {
+	return parallelEach(len(files), fileWorkers, func(_ int, i int) error {
+		mapping := files_diff.Mappings[files[i]]
+
+		err := copyTemplateFile(mapping, dst_dir+"/"+files[i])
+		if err != nil {
+			return fmt.Errorf("copying %q: %w", files[i], err)
+		}
+		logVerbose("wrote %s/%s from %s", dst_dir, files[i], mapping.Source)
+
+		return nil
+	})
+}
+
+// copyTemplateFile writes the managed file of mapping, rendered if it's
+// transformed, to dst with the mode of its source. Missing parent
+// directories of dst are created, both for new and changed files.
+func copyTemplateFile(mapping fileMapping, dst string) error {
+	stat, err := os.Stat(mapping.Source)
+	if err != nil {
+		return err
+	}
+
+	var content io.Reader
+	if mapping.transformed() {
+		rendered, err := mapping.render()
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(rendered)
+	} else {
+		template_file, err := os.Open(mapping.Source)
+		if err != nil {
+			return err
+		}
+		defer template_file.Close()
+		content = template_file
+	}
+
+	return writeFileAtomic(dst, content, fileMode(stat.Mode()))
+}
+
+// writeFileAtomic writes the contents of r to file_path with mode by way of a
+// temporary file in the same directory that is renamed into place once fully
+// written. If anything fails file_path is left untouched.
+func writeFileAtomic(file_path string, r io.Reader, mode os.FileMode) error {
+	dir := path.Dir(file_path)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	tmp_file, err := os.CreateTemp(dir, "."+path.Base(file_path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp_path := tmp_file.Name()
+
+	// os.CreateTemp creates files only readable by the owner
+	err = tmp_file.Chmod(mode)
+	if err == nil {
+		_, err = io.Copy(tmp_file, r)
+	}
+	if err == nil {
+		err = tmp_file.Close()
+	} else {
+		tmp_file.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp_path, file_path)
+	}
+	if err != nil {
+		os.Remove(tmp_path)
+		return err
+	}
+
+	return nil
+}
+
+// Files containing this marker in one of their first ignoreMarkerLines lines
+// are not synced, e.g. "# ecsact-common:ignore"
+const (
+	ignoreMarker      = "ecsact-common:ignore"
+	ignoreMarkerLines = 5
+)
+
+// hasIgnoreMarker reports whether the text file at file_path opts out of being
+// synced with ignoreMarker. Binary files never opt out.
+func hasIgnoreMarker(file_path string) (bool, error) {
+	f, err := os.Open(file_path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 4096)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	head = head[:n]
+
+	if isBinary(head) {
+		return false, nil
+	}
+
+	lines := bytes.SplitN(head, []byte("\n"), ignoreMarkerLines+1)
+	for _, line := range lines[:min(len(lines), ignoreMarkerLines)] {
+		if bytes.Contains(line, []byte(ignoreMarker)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// getAllFiles walks the managed files in dir, skipping the ones matched by
+// its syncIgnoreFile or opting out with ignoreMarker.
+func getAllFiles(dir string, trace *fileTrace) ([]string, error) {
 	var all_files []string
 
-	err := filepath.Walk(dir,
+	ignore, err := readSyncIgnore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(dir,
 		func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
 
-			if !info.IsDir() {
+			rel_path, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			if rel_path != "." && syncIgnored(ignore, rel_path, info.IsDir()) {
+				trace_path := filepath.ToSlash(rel_path)
+				if info.IsDir() {
+					trace_path += "/"
+				}
+				if trace_path != syncIgnoreFile {
+					trace.add(trace_path, "matched by %s", syncIgnoreFile)
+					trace.decide(trace_path, "skip (ignored)")
+				}
+
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			ignored, err := hasIgnoreMarker(path)
+			if err != nil {
+				return err
+			}
+
+			if ignored {
+				trace.add(filepath.ToSlash(rel_path), "opts out with %q", ignoreMarker)
+				trace.decide(filepath.ToSlash(rel_path), "skip (ignored)")
+			} else {
 				all_files = append(all_files, path)
 			}
 			return nil
@@ -110,226 +596,569 @@ func getAllFiles(dir string) ([]string, error) {
 	return all_files, nil
 }
 
-func findPrNumber(repo string, title string, author string) (*int, error) {
-	type PrAuthor struct {
-		IsBot bool   `yaml:"is_bot"`
-		Login string `yaml:"login"`
+// newSignature creates the commit author signature at time now, converted to
+// the configured commit timezone if there is one.
+func newSignature(c *Config, now time.Time) (*object.Signature, error) {
+	if c.CommitTimezone != "" {
+		loc, err := time.LoadLocation(c.CommitTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("commit_timezone: %w", err)
+		}
+		now = now.In(loc)
 	}
 
-	type PrListItem struct {
-		Author PrAuthor `yaml:"author"`
-		Number int      `yaml:"number"`
-		Title  string   `yaml:"title"`
+	signature := &object.Signature{
+		Name:  c.AuthorName,
+		Email: c.AuthorEmail,
+		When:  now,
 	}
-
-	cmd := exec.Command(
-		"gh", "pr", "list",
-		"-R", fmt.Sprintf("ecsact-dev/%s", repo),
-		"--json=title,number,author",
-	)
-	output, err := cmd.Output()
-	if err != nil {
-		log.Fatal(err)
+	if signature.Name == "" {
+		signature.Name = c.AuthorLogin
 	}
-
-	var items []PrListItem
-	err = yaml.Unmarshal(output, &items)
-	checkErr(err)
-
-	for _, item := range items {
-		if item.Author.Login != author {
-			continue
-		}
-		if item.Title != title {
-			continue
-		}
-
-		return &item.Number, nil
+	if signature.Email == "" {
+		signature.Email = c.AuthorLogin + "@users.noreply.github.com"
 	}
-
-	return nil, nil
+	return signature, nil
 }
 
 func updatePr(
 	repo_name string,
+	repo_clone_dir string,
+	pr_num int,
 	branch_name string,
 	repo *git.Repository,
 	worktree *git.Worktree,
-	prTitle string,
+	commit_message string,
 	signature *object.Signature,
-) {
-	err := worktree.AddGlob(".")
-	checkErr(err)
-
-	_, err = worktree.Commit(prTitle, &git.CommitOptions{
-		Author: signature,
-	})
-	checkErr(err)
+	pr_body string,
+	respect_reviews bool,
+	force bool,
+) (bool, error) {
+	if respect_reviews {
+		unresolved, err := prClient.UnresolvedReviewThreads(repo_name, pr_num)
+		if err != nil {
+			return false, fmt.Errorf("querying review threads of %s#%d: %w", repo_name, pr_num, err)
+		}
 
-	cmd := exec.Command("git", "push", "origin", "-u", branch_name, "--force")
-	cmd.Dir = "clones/" + repo_name
+		if unresolved > 0 {
+			logWarn(
+				"not updating %s#%d, it has %d unresolved review threads (use -force-update to override)",
+				repo_name, pr_num, unresolved,
+			)
+			return false, nil
+		}
+	}
 
-	err = cmd.Run()
-	checkErr(err)
+	// Keep the body in line with the latest file set
+	current_body, err := prClient.ViewPrBody(repo_name, pr_num)
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(current_body) != strings.TrimSpace(pr_body) {
+		err = prClient.EditPrBody(repo_name, pr_num, pr_body)
+		if err != nil {
+			return false, err
+		}
+		logInfo("Updated the body of %s#%d", repo_name, pr_num)
+	}
 
-	cmd = exec.Command(
-		"gh", "pr", "merge", "chore/sync-with-ecsact-common", "--auto",
-		"-R", fmt.Sprintf("ecsact-dev/%s", repo_name),
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	err = commitAndPush(repo_clone_dir, branch_name, worktree, commit_message, signature, force)
+	if err == errNothingToCommit {
+		logInfo("%s#%d is already up to date", repo_name, pr_num)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
 
-	err = cmd.Run()
-	checkErr(err)
+	return true, prClient.EnableAutoMerge(repo_name, branch_name)
 }
 
 func createPr(
 	repo_name string,
+	repo_clone_dir string,
 	branch_name string,
+	base_branch string,
 	repo *git.Repository,
 	worktree *git.Worktree,
 	prTitle string,
+	prBody string,
+	commit_message string,
 	signature *object.Signature,
-) {
-	err := worktree.AddGlob(".")
-	checkErr(err)
+) (int, string, error) {
+	// The sync branch may be left over from a previous run whose PR was closed
+	// or deleted. Force pushing resets it to the fresh commit below so the new
+	// PR never contains its stale commits.
+	tip, err := remoteBranchTip(repo_clone_dir, branch_name)
+	if err != nil {
+		return 0, "", err
+	}
+	if !tip.IsZero() {
+		logInfo("%s already exists in %s without a PR, resetting it", branch_name, repo_name)
+	}
 
-	_, err = worktree.Commit(prTitle, &git.CommitOptions{
-		Author: signature,
-	})
-	checkErr(err)
+	err = commitAndPush(repo_clone_dir, branch_name, worktree, commit_message, signature, true)
+	if err != nil {
+		return 0, "", err
+	}
 
-	cmd := exec.Command("git", "push", "origin", "-u", branch_name, "--force")
-	cmd.Dir = "clones/" + repo_name
+	pr_num, pr_url, err := prClient.CreatePr(repo_name, branch_name, base_branch, prTitle, prBody)
+	if err != nil {
+		return 0, "", err
+	}
 
-	err = cmd.Run()
-	checkErr(err)
+	return pr_num, pr_url, prClient.EnableAutoMerge(repo_name, branch_name)
+}
 
-	cmd = exec.Command(
-		"gh", "pr", "create",
-		"-R", fmt.Sprintf("ecsact-dev/%s", repo_name),
-		"-t", prTitle,
-		"-b", "Automatically created by https://github.com/ecsact-dev/ecsact_common",
-		"-H", branch_name,
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err = cmd.Run()
-	checkErr(err)
+// cloneUrl returns the URL repo_name is cloned from and pushed to. A
+// configured clone_url replaces {repo} with the repo name.
+func cloneUrl(c *Config, repo_name string) string {
+	if c.CloneUrl != "" {
+		return strings.ReplaceAll(c.CloneUrl, "{repo}", repo_name)
+	}
 
-	cmd = exec.Command(
-		"gh", "pr", "merge", "chore/sync-with-ecsact-common", "--auto",
-		"-R", fmt.Sprintf("ecsact-dev/%s", repo_name),
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if *gitTransport == "ssh" {
+		return fmt.Sprintf("git@github.com:%s.git", orgRepo(repo_name))
+	}
 
-	err = cmd.Run()
-	checkErr(err)
+	gh_token := os.Getenv("GIT_CLONE_GH_TOKEN")
+	if gh_token != "" {
+		return fmt.Sprintf("https://%s:%s@github.com/%s.git", c.AuthorLogin, gh_token, orgRepo(repo_name))
+	}
+	return fmt.Sprintf("https://github.com/%s.git", orgRepo(repo_name))
 }
 
-// gh pr create -R ecsact-dev/ecsact_runtime -t "chore: sync with ecsact_common" -b "Automatically created by https://github.com/ecsact-dev/ecsact_runtime" -H chore/sync-with-ecsact-common -B main
+var (
+	outputFormat       = flag.String("output", "text", "`format` of the run result, text or json to write a JSON summary of every repo to stdout")
+	configFile         = flag.String("config", "config.yml", "read the config from `file`, FilesDir is relative to it")
+	jobs               = flag.Int("jobs", 4, "number of repos synced in parallel")
+	verbose            = flag.Bool("v", false, "verbose output, also log every file written and every git and gh command run")
+	quiet              = flag.Bool("q", false, "quiet output, only errors and the final summary")
+	maxRetries         = flag.Int("max-retries", -1, "retry transient clone, push and PR failures `n` times with exponential backoff, defaults to gh_retries or 2")
+	checkDrift         = flag.Bool("check", false, "exit nonzero when any repo is out of sync without pushing or opening PRs")
+	dryRun             = flag.Bool("dry-run", false, "clone and compare every repo, printing what would be synced without pushing or opening PRs")
+	allowLicenseChange = flag.Bool("allow-license-change", false, "sync managed license files even when the repo has a different license")
+	forceUpdate        = flag.Bool("force-update", false, "update sync PRs even when they have unresolved review threads")
+	pruneBranches      = flag.Bool("prune-branches", false, "delete sync branches without an open PR after syncing")
+	closeStale         = flag.Bool("close-stale", false, "close the open sync PR of repos that are back in sync")
+	onlyRepos          = flag.String("repos", "", "only sync the comma separated `repos`, each of which must be configured")
+	matchPattern       = flag.String("match", "", "only sync repos whose name matches the regular expression `regex`")
+	skipFile           = flag.String("skip-file", "", "skip repos listed in `path` (one per line) for this run only")
+	sarifOut           = flag.String("sarif-out", "", "write out of sync files as a SARIF report to `file` without making changes")
+	dedupePrs          = flag.Bool("dedupe-prs", false, "close all but the most recent open sync PR in each repo and exit")
+	deadline           = flag.Duration("deadline", 0, "stop starting new repos once the run has taken longer than `duration`")
+	runTimeout         = flag.Duration("timeout", 0, "cancel the run, including in flight clones and pushes, once it has taken longer than `duration`")
+	cacheFile          = flag.String("cache", "", "persist source hashes and repo comparisons in `file` across runs")
+	allowDirty         = flag.Bool("allow-dirty", false, "sync even when the managed files have uncommitted changes")
+	keepClones         = flag.Bool("keep-clones", false, "keep clones in ./clones for reuse and debugging instead of removing temporary clones")
+	gitTransport       = flag.String("transport", "https", "clone and push over `transport`, https or ssh")
+	sshKey             = flag.String("ssh-key", "", "private key `file` for -transport ssh instead of the ssh agent")
+	reportUnmanaged    = flag.Bool("report-unmanaged-candidates", false, "report repo files matching managed path patterns that aren't managed without making changes")
+	interactive        = flag.Bool("interactive", false, "show the changes for each repo and ask before syncing it, optionally only some of the files")
+	skipModified       = flag.Bool("skip-modified", false, "don't overwrite synced files that were edited in the repo since they were last synced")
+	patchDir           = flag.String("patch-dir", "", "write the changes made to each repo as a patch to `dir`/<repo>.patch")
+	changelogOut       = flag.String("changelog-out", "", "write a markdown changelog of the files synced to each repo to `file`")
+	strictConfig       = flag.Bool("strict-config", false, "fail when a config path or glob matches no managed file")
+	materializeRepo    = flag.String("materialize", "", "write the managed files as synced to `repo` into the directory given as the first argument and exit")
+	classifyOnly       = flag.Bool("classify-changes", false, "report whether each changed file differs only in formatting without making changes")
+	signoff            = flag.Bool("signoff", false, "append a Signed-off-by trailer to sync commits")
+	syncSetName        = flag.String("sync-set", "", "only sync the sync set `name` of sync_sets")
+	explainRepo        = flag.String("explain", "", "print why each managed file would or would not be synced to `repo` without making changes")
+)
+
+// readOnlyRun reports whether the flags select a mode that only reports on
+// the repos without pushing or opening PRs.
+func readOnlyRun() bool {
+	return *dryRun || *checkDrift || *sarifOut != "" || *explainRepo != "" || *reportUnmanaged || *classifyOnly
+}
 
 func main() {
+	start_time := time.Now()
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	flag.Parse()
+
+	switch {
+	case *verbose && *quiet:
+		log.Fatal("-v and -q are mutually exclusive")
+	case *verbose:
+		verbosity = levelVerbose
+	case *quiet:
+		verbosity = levelQuiet
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *runTimeout)
+		defer cancel()
+	}
+	runCtx = ctx
+
+	// The JSON summary is the only output on stdout, logs go to stderr
+	var json_out *os.File
+	switch *outputFormat {
+	case "text":
+	case "json":
+		json_out = os.Stdout
+		os.Stdout = os.Stderr
+	default:
+		log.Fatalf("-output must be text or json, got %q", *outputFormat)
+	}
 
-	c, err := readConfig("config.yml")
+	c, err := readConfig(*configFile)
 	checkErr(err)
 
-	files, err := getAllFiles(c.FilesDir)
+	err = c.Validate()
 	checkErr(err)
 
-	for _, repo_name := range c.Repos {
-		repo_clone_dir := fmt.Sprintf("./clones/%s", repo_name)
+	if c.Org != "" {
+		githubOrg = c.Org
+	}
 
-		var clone_url string
-		gh_token := os.Getenv("GIT_CLONE_GH_TOKEN")
-		if gh_token != "" {
-			clone_url = fmt.Sprintf("https://%s:%s@github.com/ecsact-dev/%s.git", c.AuthorLogin, gh_token, repo_name)
-		} else {
-			clone_url = fmt.Sprintf("https://github.com/ecsact-dev/%s.git", repo_name)
-		}
+	err = setupTransport(*gitTransport, *sshKey)
+	checkErr(err)
 
-		repo, err := git.PlainClone(repo_clone_dir, false, &git.CloneOptions{
-			URL: clone_url,
-		})
+	commitSigning, err = newCommitSigner(c.Signing)
+	checkErr(err)
+
+	// Set before the first gh call, the one of the topic discovery
+	if c.GhTimeout > 0 {
+		ghTimeout = c.GhTimeout
+	}
+	if c.GhRetries != nil {
+		retryCount = *c.GhRetries
+	}
+	if *maxRetries >= 0 {
+		retryCount = *maxRetries
+	}
+	ghDispatcher = newApiDispatcher(c.ApiConcurrency, c.ApiInterval)
+
+	if c.ReposURL != "" {
+		inventory, err := fetchInventory(c.ReposURL)
+		checkErr(err)
+		mergeInventory(c, inventory)
+	}
+
+	if c.RepoTopic != "" {
+		topic_repos, err := topicRepos(c.RepoTopic)
 		checkErr(err)
+		mergeInventory(c, topic_repos)
+	}
+
+	err = checkFileSets(c)
+	checkErr(err)
+
+	err = checkSyncSets(c)
+	checkErr(err)
+
+	if *onlyRepos != "" {
+		c.Repos, err = selectRepos(c.Repos, *onlyRepos)
+		if err != nil {
+			log.Fatalf("-repos: %s", err)
+		}
+	}
 
-		files_diff, err := getFilesDiff(repo_clone_dir, files, c.FilesDir+"/")
+	if *skipFile != "" {
+		skip, err := readSkipFile(*skipFile)
 		checkErr(err)
+		c.Repos = skipRepos(c.Repos, skip, *skipFile)
+	}
 
-		if len(files_diff.ChangedFiles) == 0 && len(files_diff.NewFiles) == 0 {
-			fmt.Printf("No changes for %s\n", repo_name)
-			continue
+	if *matchPattern != "" {
+		pattern, err := regexp.Compile(*matchPattern)
+		if err != nil {
+			log.Fatalf("-match: %s", err)
 		}
+		c.Repos = matchRepos(c.Repos, pattern)
+	}
+
+	sets, err := c.syncSetConfigs(*syncSetName)
+	checkErr(err)
+
+	// Subcommands working on the managed files of a single set
+	single_set := flag.Arg(0) == "manifest" || *explainRepo != ""
+	if single_set && len(sets) > 1 {
+		log.Fatal("-sync-set is required with several sync_sets")
+	}
+
+	var trace *fileTrace
+	if *explainRepo != "" {
+		if !slices.Contains(sets[0].Repos, *explainRepo) {
+			log.Fatalf("-explain: %q is not in the config repos", *explainRepo)
+		}
+		trace = newFileTrace()
+	}
 
-		fmt.Printf("::group::%s\n", repo_name)
+	set_files := make([][]string, len(sets))
+	for i, set_config := range sets {
+		set_files[i], err = managedFiles(set_config, trace)
+		checkErr(err)
 
-		worktree, err := repo.Worktree()
+		err = checkConfigRefs(set_config, set_files[i], *strictConfig)
 		checkErr(err)
+	}
 
-		head, err := repo.Head()
+	if flag.Arg(0) == "manifest" {
+		err = manifestCommand(sets[0], set_files[0], flag.Args()[1:])
 		checkErr(err)
+		return
+	}
 
-		branch_name := "chore/sync-with-ecsact-common"
+	if *materializeRepo != "" {
+		if flag.NArg() != 1 {
+			log.Fatal("usage: -materialize <repo> <outdir>")
+		}
+		err = materialize(sets, set_files, *materializeRepo, flag.Arg(0))
+		checkErr(err)
+		return
+	}
 
-		err = worktree.Checkout(&git.CheckoutOptions{
-			Hash:   head.Hash(),
-			Branch: plumbing.NewBranchReferenceName(branch_name),
-			Create: true,
-			Force:  true,
-			Keep:   false,
-		})
+	var secret_scanner *secretScanner
+	if c.SecretScan.Mode != "" {
+		secret_scanner, err = newSecretScanner(c.SecretScan)
 		checkErr(err)
+	}
 
-		for _, new_file := range files_diff.NewFiles {
-			template_file, err := os.Open(c.FilesDir + "/" + new_file)
-			checkErr(err)
+	if c.FileWorkers > 0 {
+		fileWorkers = c.FileWorkers
+	}
+	if c.LargeFileSize > 0 {
+		largeFileSize = c.LargeFileSize
+	}
 
-			repo_file_path := repo_clone_dir + "/" + new_file
-			os.MkdirAll(path.Dir(repo_file_path), os.ModePerm)
+	prClient, err = newPrClient(c)
+	checkErr(err)
 
-			repo_file, err := os.Create(repo_file_path)
-			checkErr(err)
+	gh_version, err := detectGhVersion()
+	if err != nil && c.PrClient == "api" {
+		if features := ghFeatures(c); len(features) > 0 {
+			log.Fatalf("gh is required by %s even with pr_client api: %s", strings.Join(features, ", "), err)
+		}
+		logVerbose("gh is unavailable, using the GitHub API only: %s", err)
+	} else {
+		checkErr(err)
+		ghVariant = ghCommandVariantFor(gh_version)
+	}
+
+	// Anonymous clones are fine as long as nothing is pushed
+	if !readOnlyRun() {
+		err = checkGithubAuth()
+		checkErr(err)
+	}
 
-			_, err = io.Copy(repo_file, template_file)
+	if *dedupePrs {
+		for _, set_config := range sets {
+			matcher, err := newSyncPrMatcher(set_config)
 			checkErr(err)
 
-			fmt.Printf("new %s\n", new_file)
+			for _, repo_name := range set_config.Repos {
+				err = dedupeSyncPrs(set_config, repo_name, matcher)
+				checkErr(err)
+			}
 		}
+		return
+	}
 
-		for _, changed_file := range files_diff.ChangedFiles {
-			template_file_path := c.FilesDir + "/" + changed_file
-			template_file, err := os.Open(template_file_path)
-			checkErr(err)
+	change_detect, err := parseChangeDetect(c.ChangeDetect)
+	checkErr(err)
 
-			repo_file_path := repo_clone_dir + "/" + changed_file
-			repo_file, err := os.Create(repo_file_path)
-			checkErr(err)
+	soft_normalizers, err := parseSoftChangeNormalizers(c.SoftChangeNormalizers)
+	checkErr(err)
 
-			_, err = io.Copy(repo_file, template_file)
+	source_sha := sourceSha()
+	if source_sha != "" && !*allowDirty {
+		for _, set_config := range sets {
+			err = checkSourceClean(set_config.FilesDir)
 			checkErr(err)
+		}
+	}
 
-			fmt.Printf("changed %s\n", changed_file)
+	if *cacheFile != "" {
+		hashCache, err = loadCompareCache(*cacheFile)
+		checkErr(err)
+	}
+
+	// Reporting drift as SARIF makes no changes to any repo
+	var sarif *sarifLog
+	if *sarifOut != "" {
+		sarif = newSarifLog()
+	}
+
+	var changes *changelog
+	if *changelogOut != "" {
+		changes = newChangelog()
+	}
+
+	// Going ahead without asking would push what was meant to be reviewed
+	select_files := *interactive && !readOnlyRun()
+	if select_files && !isTerminal(os.Stdin) {
+		log.Fatal("-interactive requires stdin to be a terminal")
+	}
+
+	// Prompting for several repos at once would be confusing
+	jobs_count := *jobs
+	if select_files {
+		jobs_count = 1
+	}
+
+	failed := false
+	var json_results []*repoResult
+	for i, set_config := range sets {
+		if set_config.SetName != "" {
+			logInfo("Syncing the %s sync set", set_config.SetName)
 		}
 
-		pr_num, err := findPrNumber(repo_name, c.PrTitle, c.AuthorLogin)
+		sync_run := &repoSync{
+			c:                set_config,
+			files:            set_files[i],
+			change_detect:    change_detect,
+			soft_normalizers: soft_normalizers,
+			source_sha:       source_sha,
+			secret_scanner:   secret_scanner,
+			trace:            trace,
+			sarif:            sarif,
+			changes:          changes,
+			select_files:     select_files,
+		}
+		outcome := sync_run.syncAll(jobs_count, start_time)
+
+		if set_config.SetName != "" {
+			fmt.Printf("Sync set %s:\n", set_config.SetName)
+		}
+		printSummary(set_config.Repos, outcome.succeeded, outcome.failures, outcome.cancelled, outcome.pr_urls, outcome.skipped)
+		json_results = append(json_results, outcome.results...)
+		if len(outcome.failures) > 0 || len(outcome.cancelled) > 0 {
+			failed = true
+		}
+	}
+
+	if !*checkDrift && sarif == nil && trace == nil {
+		printTotals(json_results)
+	}
+
+	err = hashCache.save()
+	checkErr(err)
+
+	if sarif != nil {
+		err = sarif.write(*sarifOut)
+		checkErr(err)
+	}
+
+	if changes != nil {
+		err = changes.write(*changelogOut)
+		checkErr(err)
+	}
+
+	if json_out != nil {
+		err = writeJsonResults(json_out, c.Repos, json_results)
 		checkErr(err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// syncOutcome is the result of syncing every repo of a config.
+type syncOutcome struct {
+	succeeded []string
+	failures  map[string]error
+	cancelled []string
+	results   []*repoResult
+	// URL of the sync PR of each repo that has one
+	pr_urls map[string]string
+	// Why each skipped repo was skipped
+	skipped map[string]string
+}
+
+// syncAll syncs every repo of s.c with up to jobs_count in parallel, then
+// prunes sync branches if requested. Repos aren't started once the run was
+// cancelled or -deadline has passed since start_time.
+func (s *repoSync) syncAll(jobs_count int, start_time time.Time) *syncOutcome {
+	c := s.c
+	not_processed := make([]bool, len(c.Repos))
+	not_started := make([]bool, len(c.Repos))
+	results := make(chan *repoResult)
+	go func() {
+		parallelEach(len(c.Repos), jobs_count, func(_ int, i int) error {
+			repo_name := c.Repos[i]
+			if *deadline > 0 && time.Since(start_time) > *deadline {
+				not_processed[i] = true
+				return nil
+			}
+			if runCtx.Err() != nil {
+				not_started[i] = true
+				return nil
+			}
+
+			if *explainRepo != "" && repo_name != *explainRepo {
+				return nil
+			}
 
-		if pr_num == nil {
-			createPr(repo_name, branch_name, repo, worktree, c.PrTitle, &object.Signature{
-				Name:  c.AuthorLogin,
-				Email: c.AuthorLogin + "@users.noreply.github.com",
-				When:  time.Now(),
-			})
+			result := newRepoResult(repo_name)
+			result.Set = c.SetName
+			result.setErr(s.syncRepo(repo_name, result))
+			results <- result
+			return nil
+		})
+		close(results)
+	}()
+
+	outcome := &syncOutcome{failures: map[string]error{}, pr_urls: map[string]string{}, skipped: map[string]string{}}
+	for result := range results {
+		if result.err != nil && runCtx.Err() != nil {
+			// Whatever failed was most likely interrupted by the cancellation
+			logInfo("Cancelled %s: %s", result.Repo, result.err)
+			outcome.cancelled = append(outcome.cancelled, result.Repo)
+			result.Action = "cancelled"
+		} else if result.err != nil {
+			logError("syncing %s failed: %s", result.Repo, result.err)
+			outcome.failures[result.Repo] = result.err
 		} else {
-			updatePr(repo_name, branch_name, repo, worktree, c.PrTitle, &object.Signature{
-				Name:  c.AuthorLogin,
-				Email: c.AuthorLogin + "@users.noreply.github.com",
-				When:  time.Now(),
-			})
+			outcome.succeeded = append(outcome.succeeded, result.Repo)
+		}
+		if result.PrUrl != "" {
+			outcome.pr_urls[result.Repo] = result.PrUrl
+		}
+		if result.Action == "skipped" {
+			outcome.skipped[result.Repo] = result.SkipReason
+		}
+		outcome.results = append(outcome.results, result)
+	}
+
+	if *dryRun {
+		logInfo("Dry run: %d of %d repos would get a sync PR", s.dry_run_prs.Load(), len(c.Repos))
+	}
+
+	var not_processed_repos []string
+	for i, repo_name := range c.Repos {
+		if not_processed[i] {
+			not_processed_repos = append(not_processed_repos, repo_name)
+		}
+		if not_started[i] {
+			outcome.cancelled = append(outcome.cancelled, repo_name)
+			result := newRepoResult(repo_name)
+			result.Set = c.SetName
+			result.Action = "cancelled"
+			outcome.results = append(outcome.results, result)
 		}
-		fmt.Printf("::endgroup::\n")
 	}
+	if len(not_processed_repos) > 0 {
+		logInfo(
+			"Deadline of %s exceeded, not processed: %s",
+			*deadline, strings.Join(not_processed_repos, ", "),
+		)
+	}
+
+	if *pruneBranches && runCtx.Err() == nil && !readOnlyRun() {
+		for _, repo_name := range c.Repos {
+			err := pruneSyncBranches(repo_name, c.syncBranch(repo_name))
+			if err != nil {
+				logError("pruning sync branches of %s failed: %s", repo_name, err)
+				outcome.failures[repo_name] = errors.Join(outcome.failures[repo_name], err)
+			}
+		}
+	}
+
+	return outcome
 }
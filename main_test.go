@@ -0,0 +1,498 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestCopyTemplateFileMode(t *testing.T) {
+	for _, mode := range []os.FileMode{0644, 0755, 0600, 0750} {
+		t.Run(mode.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "files", "hook.sh")
+			dst := filepath.Join(dir, "repo", "hook.sh")
+			writeTestFile(t, source, "#!/bin/sh\n", mode)
+			// The existing file's mode must not survive the sync
+			writeTestFile(t, dst, "old\n", 0666)
+
+			err := copyTemplateFile(fileMapping{Source: source, Dest: "hook.sh"}, dst)
+			if err != nil {
+				t.Fatalf("copyTemplateFile() failed: %v", err)
+			}
+
+			stat, err := os.Stat(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.Mode().Perm() != mode {
+				t.Errorf("copyTemplateFile() wrote mode %v, want %v", stat.Mode().Perm(), mode)
+			}
+		})
+	}
+}
+
+// failingReader returns content and then err instead of io.EOF.
+type failingReader struct {
+	content io.Reader
+	err     error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.content.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	read_err := errors.New("read failed")
+
+	tests := []struct {
+		name string
+		// Creates what is at the destination beforehand
+		setup     func(t *testing.T, dst string)
+		r         io.Reader
+		want_err  bool
+		want_file string
+	}{
+		{
+			name:      "new file",
+			r:         strings.NewReader("new"),
+			want_file: "new",
+		},
+		{
+			name:      "replaces",
+			setup:     func(t *testing.T, dst string) { writeTestFile(t, dst, "old", 0644) },
+			r:         strings.NewReader("new"),
+			want_file: "new",
+		},
+		{
+			name:      "read error",
+			setup:     func(t *testing.T, dst string) { writeTestFile(t, dst, "old", 0644) },
+			r:         &failingReader{content: strings.NewReader("partial"), err: read_err},
+			want_err:  true,
+			want_file: "old",
+		},
+		{
+			name: "rename error",
+			setup: func(t *testing.T, dst string) {
+				writeTestFile(t, filepath.Join(dst, "child"), "x", 0644)
+			},
+			r:        strings.NewReader("new"),
+			want_err: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "nested", "dir")
+			dst := filepath.Join(dir, "file.txt")
+			if test.setup != nil {
+				test.setup(t, dst)
+			}
+
+			err := writeFileAtomic(dst, test.r, 0640)
+			if test.want_err != (err != nil) {
+				t.Fatalf("writeFileAtomic() = %v, want an error %v", err, test.want_err)
+			}
+
+			if test.want_file != "" {
+				content, err := os.ReadFile(dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(content) != test.want_file {
+					t.Errorf("destination holds %q, want %q", content, test.want_file)
+				}
+			}
+			if !test.want_err {
+				stat, err := os.Stat(dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stat.Mode().Perm() != 0640 {
+					t.Errorf("destination mode = %v, want 0640", stat.Mode().Perm())
+				}
+			}
+
+			// Failed writes must not leave temporary files behind
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if strings.HasSuffix(entry.Name(), ".tmp") {
+					t.Errorf("left %s behind", entry.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestCopyTemplateFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		mapping fileMapping
+		// Path of the destination below the repo, its parents don't exist
+		dest string
+		want string
+	}{
+		{
+			name:    "plain",
+			content: "root = true\n",
+			dest:    "a/b/c/.editorconfig",
+			want:    "root = true\n",
+		},
+		{
+			name:    "template",
+			content: "name: {{.RepoName}} ({{.Org}})\n",
+			mapping: fileMapping{Template: &fileTemplateData{RepoName: "ecsact_cli", Org: "ecsact-dev", Config: &Config{}}},
+			dest:    ".github/workflows/main.yml",
+			want:    "name: ecsact_cli (ecsact-dev)\n",
+		},
+		{
+			name:    "crlf",
+			content: "a\nb\n",
+			mapping: fileMapping{Eol: "crlf"},
+			dest:    "deep/nested/dir/file.txt",
+			want:    "a\r\nb\r\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			mapping := test.mapping
+			mapping.Source = filepath.Join(dir, "files", "source")
+			mapping.Dest = test.dest
+			writeTestFile(t, mapping.Source, test.content, 0644)
+
+			dst := filepath.Join(dir, "repo", filepath.FromSlash(test.dest))
+			err := copyTemplateFile(mapping, dst)
+			if err != nil {
+				t.Fatalf("copyTemplateFile() failed: %v", err)
+			}
+
+			content, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != test.want {
+				t.Errorf("copyTemplateFile() wrote %q, want %q", content, test.want)
+			}
+		})
+	}
+}
+
+func TestCopyTemplateFileMissingSource(t *testing.T) {
+	dir := t.TempDir()
+	mapping := fileMapping{Source: filepath.Join(dir, "missing"), Dest: "a/b"}
+	err := copyTemplateFile(mapping, filepath.Join(dir, "repo", "a", "b"))
+	if err == nil {
+		t.Fatal("copyTemplateFile() = nil, want an error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "repo")); !os.IsNotExist(err) {
+		t.Errorf("copyTemplateFile() created the destination directory for a missing source")
+	}
+}
+
+// BenchmarkGetFilesDiff compares a FilesDir of thousands of files against a
+// repo where every tenth file has changed.
+func BenchmarkGetFilesDiff(b *testing.B) {
+	dir := b.TempDir()
+	files_dir := filepath.Join(dir, "files")
+	repo_dir := filepath.Join(dir, "repo")
+
+	content := strings.Repeat("some line of text\n", 50)
+	mappings := make([]fileMapping, 0, 5000)
+	for i := 0; i < cap(mappings); i++ {
+		file_rel := fmt.Sprintf("dir%02d/file%04d.txt", i%50, i)
+		source := filepath.Join(files_dir, file_rel)
+		writeTestFile(b, source, content, 0644)
+		repo_content := content
+		if i%10 == 0 {
+			repo_content += "changed\n"
+		}
+		writeTestFile(b, filepath.Join(repo_dir, file_rel), repo_content, 0644)
+		mappings = append(mappings, fileMapping{Source: source, Dest: file_rel})
+	}
+
+	detect, err := parseChangeDetect(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		files_diff, err := getFilesDiff(repo_dir, nil, mappings, nil, detect, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(files_diff.ChangedFiles) != len(mappings)/10 {
+			b.Fatalf("getFilesDiff() found %d changed files, want %d", len(files_diff.ChangedFiles), len(mappings)/10)
+		}
+	}
+}
+
+func TestNewSignature(t *testing.T) {
+	local := time.FixedZone("runner", -7*60*60)
+	now := time.Date(2024, 3, 1, 17, 30, 0, 0, local)
+
+	tests := []struct {
+		name       string
+		c          *Config
+		want_loc   string
+		want_name  string
+		want_email string
+		want_err   bool
+	}{
+		{
+			name:       "runner timezone",
+			c:          &Config{AuthorLogin: "seaubot"},
+			want_loc:   "runner",
+			want_name:  "seaubot",
+			want_email: "seaubot@users.noreply.github.com",
+		},
+		{
+			name:       "utc",
+			c:          &Config{AuthorLogin: "seaubot", AuthorName: "Seau Bot", AuthorEmail: "bot@example.com", CommitTimezone: "UTC"},
+			want_loc:   "UTC",
+			want_name:  "Seau Bot",
+			want_email: "bot@example.com",
+		},
+		{name: "unknown timezone", c: &Config{CommitTimezone: "Mars/Olympus_Mons"}, want_err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signature, err := newSignature(test.c, now)
+			if test.want_err {
+				if err == nil {
+					t.Fatal("newSignature() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newSignature() failed: %v", err)
+			}
+
+			if got := signature.When.Location().String(); got != test.want_loc {
+				t.Errorf("newSignature() location = %s, want %s", got, test.want_loc)
+			}
+			if !signature.When.Equal(now) {
+				t.Errorf("newSignature() time = %s, want the same instant as %s", signature.When, now)
+			}
+			if signature.Name != test.want_name || signature.Email != test.want_email {
+				t.Errorf("newSignature() = %s <%s>, want %s <%s>", signature.Name, signature.Email, test.want_name, test.want_email)
+			}
+		})
+	}
+}
+
+// TestGetFilesDiffEol checks that files configured for CRLF line endings are
+// compared as written to the repo.
+func TestGetFilesDiffEol(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		repo   string
+		// Whether the repo file still needs a sync
+		want bool
+	}{
+		{name: "repo has crlf", source: "a\nb\n", repo: "a\r\nb\r\n", want: false},
+		{name: "repo has lf", source: "a\nb\n", repo: "a\nb\n", want: true},
+		{name: "repo has mixed", source: "a\nb\n", repo: "a\r\nb\n", want: true},
+		{name: "source has crlf", source: "a\r\nb\r\n", repo: "a\r\nb\r\n", want: false},
+		{name: "content differs", source: "a\nb\n", repo: "a\r\nc\r\n", want: true},
+		{name: "binary is exempt", source: "\x00a\nb\n", repo: "\x00a\nb\n", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "files", "build.bat")
+			repo_dir := filepath.Join(dir, "repo")
+			writeTestFile(t, source, test.source, 0644)
+			writeTestFile(t, filepath.Join(repo_dir, "build.bat"), test.repo, 0644)
+
+			c := &Config{FilesDir: filepath.Join(dir, "files"), Eol: map[string]string{"*.bat": "crlf"}}
+			mappings, err := resolveMappings(c, "ecsact_cli", []string{source}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			detect, err := parseChangeDetect(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files_diff, err := getFilesDiff(repo_dir, nil, mappings, nil, detect, nil)
+			if err != nil {
+				t.Fatalf("getFilesDiff() failed: %v", err)
+			}
+			if got := len(files_diff.ChangedFiles) == 1; got != test.want {
+				t.Errorf("getFilesDiff() changed %v, want a change %v", files_diff.ChangedFiles, test.want)
+			}
+
+			// Syncing brings the repo in line
+			err = copyFiles(files_diff, repo_dir, files_diff.ChangedFiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files_diff, err = getFilesDiff(repo_dir, nil, mappings, nil, detect, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files_diff.ChangedFiles) != 0 {
+				t.Errorf("getFilesDiff() after the sync changed %v", files_diff.ChangedFiles)
+			}
+		})
+	}
+}
+
+func TestHasIgnoreMarker(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{name: "first line", content: "# ecsact-common:ignore\nfoo\n", want: true},
+		{name: "fifth line", content: "1\n2\n3\n4\n// ecsact-common:ignore\n", want: true},
+		{name: "sixth line", content: "1\n2\n3\n4\n5\n# ecsact-common:ignore\n", want: false},
+		{name: "no newline", content: "<!-- ecsact-common:ignore -->", want: true},
+		{name: "crlf", content: "a\r\n# ecsact-common:ignore\r\n", want: true},
+		{name: "none", content: "# ecsact-common\nignore\n", want: false},
+		{name: "empty", content: "", want: false},
+		{name: "binary", content: "\x00# ecsact-common:ignore\n", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			writeTestFile(t, path, test.content, 0644)
+
+			got, err := hasIgnoreMarker(path)
+			if err != nil {
+				t.Fatalf("hasIgnoreMarker() failed: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("hasIgnoreMarker(%q) = %v, want %v", test.content, got, test.want)
+			}
+		})
+	}
+
+	if _, err := hasIgnoreMarker(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("hasIgnoreMarker() of a missing file succeeded")
+	}
+}
+
+// TestGetFilesDiffHashes checks that the hashes of the diff are of the content
+// as written to the repo.
+func TestGetFilesDiffHashes(t *testing.T) {
+	dir := t.TempDir()
+	files_dir := filepath.Join(dir, "files")
+	repo_dir := filepath.Join(dir, "repo")
+	writeTestFile(t, filepath.Join(files_dir, "new.bat"), "a\nb\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "changed.txt"), "new\n", 0644)
+	writeTestFile(t, filepath.Join(repo_dir, "changed.txt"), "old\n", 0644)
+
+	c := &Config{FilesDir: files_dir, Eol: map[string]string{"*.bat": "crlf"}}
+	sources := []string{filepath.Join(files_dir, "new.bat"), filepath.Join(files_dir, "changed.txt")}
+	mappings, err := resolveMappings(c, "ecsact_cli", sources, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	detect, err := parseChangeDetect(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files_diff, err := getFilesDiff(repo_dir, nil, mappings, nil, detect, nil)
+	if err != nil {
+		t.Fatalf("getFilesDiff() failed: %v", err)
+	}
+	err = copyFiles(files_diff, repo_dir, append(files_diff.NewFiles, files_diff.ChangedFiles...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file_rel := range []string{"new.bat", "changed.txt"} {
+		content, err := os.ReadFile(filepath.Join(repo_dir, file_rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf("%x", sha256.Sum256(content))
+		if got := files_diff.Hashes[file_rel]; got != want {
+			t.Errorf("hash of %s = %q, want %q", file_rel, got, want)
+		}
+	}
+}
+
+// TestCreatePrExistingBranch creates a PR from a sync branch left over from an
+// earlier run, which must be reset instead of keeping its stale commits.
+func TestCreatePrExistingBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	remote := newTestRemote(t, map[string]string{"README.md": "# alpha\n"})
+	work := filepath.Join(t.TempDir(), "work")
+	testGit(t, filepath.Dir(work), "clone", "-q", remote, work)
+	testGit(t, work, "checkout", "-q", "-b", "ecsact-common-sync")
+	writeTestFile(t, filepath.Join(work, "stale.txt"), "stale\n", 0644)
+	testGit(t, work, "add", "-A")
+	testGit(t, work, "commit", "-q", "-m", "stale sync")
+	testGit(t, work, "push", "-q", "origin", "ecsact-common-sync")
+	main_tip := testGit(t, work, "rev-parse", "origin/main")
+
+	fake := newFakePrClient()
+	defer func(client PrClient) { prClient = client }(prClient)
+	prClient = fake
+
+	clone_dir := filepath.Join(t.TempDir(), "ecsact_cli")
+	repo, err := cloneRepo(clone_dir, remote, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = checkoutSyncBranch(repo, worktree, clone_dir, "ecsact-common-sync", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(clone_dir, ".editorconfig"), "root = true\n", 0644)
+
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	pr_num, _, err := createPr(
+		"ecsact_cli", clone_dir, "ecsact-common-sync", "main", repo, worktree,
+		"chore: sync", "body", "chore: sync", signature,
+	)
+	if err != nil {
+		t.Fatalf("createPr() failed: %v", err)
+	}
+	if pr_num != 1 || !slices.Equal(fake.created, []string{"ecsact-common-sync"}) {
+		t.Errorf("createPr() created PR %d from %v, want PR 1 from the sync branch", pr_num, fake.created)
+	}
+
+	testGit(t, work, "fetch", "-q", "origin")
+	if got := testGit(t, work, "rev-parse", "origin/ecsact-common-sync^"); got != main_tip {
+		t.Errorf("sync branch is based on %s, want main at %s", got, main_tip)
+	}
+	if got := testGit(t, work, "ls-tree", "--name-only", "origin/ecsact-common-sync"); got != ".editorconfig\nREADME.md" {
+		t.Errorf("sync branch has files %q, want the stale commit dropped", got)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Path of the manifest in each repo listing the files synced to it and the
+// hashes of their synced content. Only files listed here are ever deleted
+// from a repo.
+const repoManifestPath = ".ecsact-common-manifest.json"
+
+// Plain list of the synced files, one per line, written before the manifest.
+// Still read from repos without a manifest and removed once one is written.
+const legacyManagedListPath = ".ecsact-common/managed-files"
+
+type repoManifest struct {
+	Files []repoManifestFile `json:"files"`
+}
+
+// repoManifestFile is a file synced to a repo. Entries read from the legacy
+// list only have a Path.
+type repoManifestFile struct {
+	Path string `json:"path"`
+	// Managed file the content was synced from, relative to FilesDir
+	Source string `json:"source"`
+	// Hex sha256 and git blob hash of the synced content
+	Sha256 string `json:"sha256"`
+	Blob   string `json:"blob"`
+}
+
+// manifestPaths returns the paths of the manifest and legacy managed file
+// list of c. Each sync set keeps its own so sets never delete each other's
+// files.
+func (c *Config) manifestPaths() (string, string) {
+	if c.SetName == "" {
+		return repoManifestPath, legacyManagedListPath
+	}
+	return strings.TrimSuffix(repoManifestPath, ".json") + "-" + c.SetName + ".json",
+		legacyManagedListPath + "-" + c.SetName
+}
+
+// readRepoManifest returns the files recorded as synced to the repo in
+// repo_dir by path, falling back to the legacy list. Returns nil if nothing
+// was recorded yet.
+func readRepoManifest(repo_dir string, c *Config) (map[string]repoManifestFile, error) {
+	manifest_path, legacy_path := c.manifestPaths()
+
+	content, err := os.ReadFile(path.Join(repo_dir, manifest_path))
+	if os.IsNotExist(err) {
+		return readLegacyManagedList(path.Join(repo_dir, legacy_path))
+	} else if err != nil {
+		return nil, err
+	}
+
+	var manifest repoManifest
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]repoManifestFile{}
+	for _, file := range manifest.Files {
+		files[file.Path] = file
+	}
+	return files, nil
+}
+
+func readLegacyManagedList(list_file string) (map[string]repoManifestFile, error) {
+	content, err := os.ReadFile(list_file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	files := map[string]repoManifestFile{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		file_rel := strings.TrimSpace(scanner.Text())
+		if file_rel != "" {
+			files[file_rel] = repoManifestFile{Path: file_rel}
+		}
+	}
+	return files, scanner.Err()
+}
+
+// writeRepoManifest records the destinations of mappings as synced to the
+// repo in repo_dir, hashing their content as written to repo_dir. Files that
+// weren't synced keep their entry of the previous manifest, as do the no
+// longer managed files in kept, e.g. deletions deselected with -interactive,
+// so they're proposed again. Reports the legacy list path if it exists and
+// should be removed.
+func writeRepoManifest(
+	repo_dir string,
+	c *Config,
+	mappings []fileMapping,
+	previous map[string]repoManifestFile,
+	kept map[string]bool,
+) (string, error) {
+	manifest_path, legacy_path := c.manifestPaths()
+
+	manifest := repoManifest{Files: []repoManifestFile{}}
+	managed := map[string]bool{}
+	for _, mapping := range mappings {
+		managed[mapping.Dest] = true
+	}
+	for file_rel, synced := range previous {
+		if kept[file_rel] && !managed[file_rel] {
+			manifest.Files = append(manifest.Files, synced)
+		}
+	}
+	for _, mapping := range mappings {
+		repo_file := path.Join(repo_dir, mapping.Dest)
+		content, err := os.ReadFile(repo_file)
+		if os.IsNotExist(err) {
+			// Not synced, e.g. deselected with -interactive
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		block, err := hasManagedBlock(mapping.Source)
+		if err != nil {
+			return "", err
+		}
+		if block {
+			mapping.BlockTarget = repo_file
+		}
+		hash, err := mapping.hash()
+		if err != nil {
+			return "", err
+		}
+
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != hash {
+			// Not synced, e.g. kept with -skip-modified, so the last synced
+			// content is still what the previous entry records
+			if synced, ok := previous[mapping.Dest]; ok {
+				manifest.Files = append(manifest.Files, synced)
+			}
+			continue
+		}
+
+		manifest.Files = append(manifest.Files, repoManifestFile{
+			Path:   mapping.Dest,
+			Source: managedRelPath(c.FilesDir, mapping.Source),
+			Sha256: hash,
+			Blob:   plumbing.ComputeHash(plumbing.BlobObject, content).String(),
+		})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	content = append(content, '\n')
+
+	err = writeFileAtomic(path.Join(repo_dir, manifest_path), bytes.NewReader(content), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = os.Lstat(path.Join(repo_dir, legacy_path))
+	if err != nil {
+		return "", nil
+	}
+	return legacy_path, nil
+}
+
+// deletedFiles returns the previously synced files in manifest still present
+// in repo_dir that are no longer managed. Files matching exclude are kept
+// since the repo maintains them itself.
+func deletedFiles(repo_dir string, manifest map[string]repoManifestFile, mappings []fileMapping, exclude []string) ([]string, error) {
+	managed := map[string]bool{}
+	for _, mapping := range mappings {
+		managed[mapping.Dest] = true
+	}
+
+	var deleted []string
+	for file_rel := range manifest {
+		if managed[file_rel] || matchAnyGlob(exclude, file_rel) {
+			continue
+		}
+
+		_, err := os.Lstat(path.Join(repo_dir, file_rel))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, file_rel)
+	}
+
+	sort.Strings(deleted)
+	return deleted, nil
+}
+
+// manifestEqual reports whether repo_file still holds exactly what the
+// manifest records as synced from the current content of m, without reading
+// it. That's the case when the index shows repo_file unchanged since
+// checkout and its blob matches the manifest.
+func (fc *fileComparer) manifestEqual(m fileMapping, repo_stat os.FileInfo) (bool, error) {
+	synced, ok := fc.manifest[m.Dest]
+	if !ok || synced.Blob == "" || m.BlockTarget != "" {
+		return false, nil
+	}
+
+	entry := fc.index[m.Dest]
+	if entry == nil || entry.Hash.String() != synced.Blob {
+		return false, nil
+	}
+	if int64(entry.Size) != repo_stat.Size() || !entry.ModifiedAt.Equal(repo_stat.ModTime()) {
+		return false, nil
+	}
+
+	hash, err := m.hash()
+	if err != nil {
+		return false, err
+	}
+	return hash == synced.Sha256, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWriteRepoManifest(t *testing.T) {
+	dir := t.TempDir()
+	files_dir := filepath.Join(dir, "files")
+	repo_dir := filepath.Join(dir, "repo")
+	writeTestFile(t, filepath.Join(files_dir, "synced.txt"), "synced\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "modified.txt"), "managed\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "new.txt"), "new\n", 0644)
+	writeTestFile(t, filepath.Join(repo_dir, "synced.txt"), "synced\n", 0644)
+	writeTestFile(t, filepath.Join(repo_dir, "modified.txt"), "kept by the repo\n", 0644)
+	writeTestFile(t, filepath.Join(repo_dir, "deselected.txt"), "old\n", 0644)
+	writeTestFile(t, filepath.Join(repo_dir, "unmanaged.txt"), "old\n", 0644)
+
+	c := &Config{FilesDir: files_dir}
+	mappings := []fileMapping{
+		{Source: filepath.Join(files_dir, "synced.txt"), Dest: "synced.txt"},
+		{Source: filepath.Join(files_dir, "modified.txt"), Dest: "modified.txt"},
+		// Deselected and so never written to the repo
+		{Source: filepath.Join(files_dir, "new.txt"), Dest: "new.txt"},
+	}
+	previous := map[string]repoManifestFile{
+		"modified.txt":   {Path: "modified.txt", Sha256: "previous"},
+		"deselected.txt": {Path: "deselected.txt", Sha256: "deselected"},
+		"unmanaged.txt":  {Path: "unmanaged.txt", Sha256: "unmanaged"},
+	}
+	kept := map[string]bool{"deselected.txt": true, "new.txt": true}
+
+	_, err := writeRepoManifest(repo_dir, c, mappings, previous, kept)
+	if err != nil {
+		t.Fatalf("writeRepoManifest() failed: %v", err)
+	}
+
+	manifest, err := readRepoManifest(repo_dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for file_rel := range manifest {
+		paths = append(paths, file_rel)
+	}
+	slices.Sort(paths)
+	if want := []string{"deselected.txt", "modified.txt", "synced.txt"}; !slices.Equal(paths, want) {
+		t.Fatalf("writeRepoManifest() recorded %v, want %v", paths, want)
+	}
+
+	if manifest["synced.txt"].Source != "synced.txt" || manifest["synced.txt"].Blob == "" {
+		t.Errorf("synced.txt recorded as %+v", manifest["synced.txt"])
+	}
+	if manifest["modified.txt"].Sha256 != "previous" {
+		t.Errorf("modified.txt recorded as %+v, want the previous entry", manifest["modified.txt"])
+	}
+	if manifest["deselected.txt"].Sha256 != "deselected" {
+		t.Errorf("deselected.txt recorded as %+v, want the previous entry", manifest["deselected.txt"])
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ManifestFile describes a single managed file as resolved from the config.
+type ManifestFile struct {
+	Source string `json:"source"`
+	Path   string `json:"path"`
+	Sha256 string `json:"sha256"`
+	Mode   string `json:"mode"`
+	Eol    string `json:"eol,omitempty"`
+	// Repos the file is synced to
+	Repos []string `json:"repos"`
+	// Destination path in each repo when Path is templated
+	RepoPaths map[string]string `json:"repo_paths,omitempty"`
+}
+
+type Manifest struct {
+	Files []ManifestFile `json:"files"`
+}
+
+// buildManifest resolves every managed file the same way a sync would,
+// without touching any repo.
+func buildManifest(c *Config, files []string) (*Manifest, error) {
+	entries := map[string]*ManifestFile{}
+	for _, repo_name := range c.Repos {
+		mappings, err := resolveMappings(c, repo_name, filesForRepo(c, files, repo_name, nil), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, mapping := range mappings {
+			entry := entries[mapping.Source]
+			if entry == nil {
+				hash, err := mapping.hash()
+				if err != nil {
+					return nil, err
+				}
+
+				stat, err := os.Stat(mapping.Source)
+				if err != nil {
+					return nil, err
+				}
+
+				entry = &ManifestFile{
+					Source:    mapping.Source,
+					Path:      managedRelPath(c.FilesDir, mapping.Source),
+					Sha256:    hash,
+					Mode:      fmt.Sprintf("%04o", fileMode(stat.Mode())),
+					Eol:       mapping.Eol,
+					RepoPaths: map[string]string{},
+				}
+				entries[mapping.Source] = entry
+			}
+
+			entry.Repos = append(entry.Repos, repo_name)
+			entry.RepoPaths[repo_name] = mapping.Dest
+		}
+	}
+
+	manifest := &Manifest{Files: []ManifestFile{}}
+	for _, entry := range entries {
+		// Only list per repo paths when the destination path is templated
+		templated := false
+		for _, dest := range entry.RepoPaths {
+			if dest != entry.Path {
+				templated = true
+			}
+		}
+		if !templated {
+			entry.RepoPaths = nil
+		}
+
+		manifest.Files = append(manifest.Files, *entry)
+	}
+
+	slices.SortFunc(manifest.Files, func(a, b ManifestFile) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return manifest, nil
+}
+
+// manifestCommand implements `manifest [-o file]`, writing the managed file
+// manifest as JSON to file or stdout.
+func manifestCommand(c *Config, files []string, args []string) error {
+	flags := flag.NewFlagSet("manifest", flag.ExitOnError)
+	out := flags.String("o", "", "write the manifest to `file` instead of stdout")
+	flags.Parse(args)
+
+	manifest, err := buildManifest(c, files)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+
+	if *out != "" {
+		return os.WriteFile(*out, content, 0644)
+	}
+
+	_, err = os.Stdout.Write(content)
+	return err
+}
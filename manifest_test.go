@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// TestBuildManifest checks that the manifest lists the managed files as a
+// sync would resolve them, after the include, exclude and mapping rules.
+func TestBuildManifest(t *testing.T) {
+	files_dir := t.TempDir()
+	writeTestFile(t, filepath.Join(files_dir, "README.md"), "# common\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "docs", "guide.md"), "guide\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "docs", "draft.md"), "draft\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "scripts", "lint.sh"), "#!/bin/sh\n", 0755)
+	writeTestFile(t, filepath.Join(files_dir, "ci.yml"), "on: push\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "notes.txt"), "not managed\n", 0644)
+
+	c := &Config{
+		FilesDir: files_dir,
+		Repos:    []string{"ecsact_cli", "ecsact_runtime"},
+		Include:  []string{"*.md", "docs/**", "scripts/**", "ci.yml"},
+		Exclude:  []string{"docs/draft.md"},
+		Mappings: map[string]string{"ci.yml": ".github/workflows/{{.RepoName}}.yml"},
+		RepoConfigs: []RepoConfig{
+			{Name: "ecsact_runtime", Exclude: []string{"scripts/**"}},
+		},
+	}
+	files, err := managedFiles(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := buildManifest(c, files)
+	if err != nil {
+		t.Fatalf("buildManifest() failed: %v", err)
+	}
+
+	both := []string{"ecsact_cli", "ecsact_runtime"}
+	want := []struct {
+		path      string
+		mode      string
+		repos     []string
+		repoPaths map[string]string
+	}{
+		{path: "README.md", mode: "0644", repos: both},
+		{
+			path:  "ci.yml",
+			mode:  "0644",
+			repos: both,
+			repoPaths: map[string]string{
+				"ecsact_cli":     ".github/workflows/ecsact_cli.yml",
+				"ecsact_runtime": ".github/workflows/ecsact_runtime.yml",
+			},
+		},
+		{path: "docs/guide.md", mode: "0644", repos: both},
+		{path: "scripts/lint.sh", mode: "0755", repos: []string{"ecsact_cli"}},
+	}
+
+	if len(manifest.Files) != len(want) {
+		t.Fatalf("buildManifest() = %+v, want %d files", manifest.Files, len(want))
+	}
+	for i, file := range manifest.Files {
+		if file.Path != want[i].path || file.Mode != want[i].mode {
+			t.Errorf("file %d = %s %s, want %s %s", i, file.Path, file.Mode, want[i].path, want[i].mode)
+		}
+		if fmt.Sprint(file.Repos) != fmt.Sprint(want[i].repos) {
+			t.Errorf("%s synced to %v, want %v", file.Path, file.Repos, want[i].repos)
+		}
+		if fmt.Sprint(file.RepoPaths) != fmt.Sprint(want[i].repoPaths) {
+			t.Errorf("%s repo paths = %v, want %v", file.Path, file.RepoPaths, want[i].repoPaths)
+		}
+	}
+
+	if got, want := manifest.Files[0].Sha256, fmt.Sprintf("%x", sha256.Sum256([]byte("# common\n"))); got != want {
+		t.Errorf("README.md sha256 = %s, want %s", got, want)
+	}
+}
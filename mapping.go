@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Suffix of managed files rendered with text/template, stripped from their
+// destination path
+const templateSuffix = ".tmpl"
+
+// fileMapping maps a managed file to where it is written in a repo.
+type fileMapping struct {
+	// Path of the managed file as walked from FilesDir
+	Source string
+	// Slash separated path relative to the repo root
+	Dest string
+	// Line endings the file is written with, "lf", "crlf" or empty to keep the
+	// source line endings
+	Eol string
+	// Data the source is rendered with when it's a .tmpl file
+	Template *fileTemplateData
+	// Existing repo file the managed block of the source is merged into, empty
+	// to replace the whole file
+	BlockTarget string
+}
+
+// fileTemplateData is available to .tmpl managed files.
+type fileTemplateData struct {
+	RepoName string
+	Org      string
+	*Config
+}
+
+// transformed reports whether the destination content differs from the
+// source content, i.e. whether it must be produced with render.
+func (m fileMapping) transformed() bool {
+	return m.Eol != "" || m.Template != nil || m.BlockTarget != ""
+}
+
+// render returns the content of the managed file as it should be written to
+// the destination.
+func (m fileMapping) render() ([]byte, error) {
+	content, err := os.ReadFile(m.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Template != nil {
+		tmpl, err := template.New(path.Base(m.Source)).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return nil, err
+		}
+
+		var rendered bytes.Buffer
+		err = tmpl.Execute(&rendered, m.Template)
+		if err != nil {
+			return nil, err
+		}
+		content = rendered.Bytes()
+	}
+
+	if m.BlockTarget != "" {
+		repo_content, err := os.ReadFile(m.BlockTarget)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			content = mergeManagedBlock(content, repo_content)
+		}
+	}
+
+	if m.Eol != "" && !isBinary(content) {
+		content = convertEol(content, m.Eol)
+	}
+
+	return content, nil
+}
+
+// hash returns the hex sha256 of the rendered content.
+func (m fileMapping) hash() (string, error) {
+	stat, err := os.Stat(m.Source)
+	if err != nil {
+		return "", err
+	}
+
+	// Rendered templates and blocks depend on more than the source file
+	cacheable := m.Template == nil && m.BlockTarget == ""
+	if hash, ok := hashCache.lookupHash(m, stat); cacheable && ok {
+		return hash, nil
+	}
+
+	content, err := m.render()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if cacheable {
+		hashCache.storeHash(m, stat, hash)
+	}
+
+	return hash, nil
+}
+
+func convertEol(content []byte, eol string) []byte {
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	if eol == "crlf" {
+		content = bytes.ReplaceAll(content, []byte("\n"), []byte("\r\n"))
+	}
+	return content
+}
+
+// lookupEol returns the configured line endings for dest. When several globs
+// match the longest one wins.
+func lookupEol(eol map[string]string, dest string) string {
+	best_pattern := ""
+	result := ""
+	for pattern, value := range eol {
+		if !matchGlob(pattern, dest) {
+			continue
+		}
+		if result == "" || len(pattern) > len(best_pattern) ||
+			(len(pattern) == len(best_pattern) && pattern < best_pattern) {
+			best_pattern = pattern
+			result = value
+		}
+	}
+	return result
+}
+
+// managedRelPath returns the slash separated path of file relative to
+// files_dir.
+func managedRelPath(files_dir string, file string) string {
+	// Either path may use backslashes on Windows and could be spelled
+	// differently, e.g. "./files" for files walked as "files/..."
+	dir := path.Clean(strings.ReplaceAll(files_dir, "\\", "/"))
+	file = path.Clean(strings.ReplaceAll(file, "\\", "/"))
+	if dir == "." {
+		return file
+	}
+
+	strip_prefix := dir + "/"
+	// Windows paths are case insensitive, e.g. the drive letter
+	if len(file) > len(strip_prefix) && strings.EqualFold(file[:len(strip_prefix)], strip_prefix) {
+		return file[len(strip_prefix):]
+	}
+	return file
+}
+
+// destPathData is available to templates in destination paths.
+type destPathData struct {
+	RepoName string
+}
+
+// renderDestPath renders Go template expressions in file_rel for repo_name,
+// e.g. "{{.RepoName}}.config.yml". Paths without templates are unchanged.
+func renderDestPath(file_rel string, repo_name string) (string, error) {
+	if !strings.Contains(file_rel, "{{") {
+		return file_rel, nil
+	}
+
+	tmpl, err := template.New(file_rel).Option("missingkey=error").Parse(file_rel)
+	if err != nil {
+		return "", fmt.Errorf("destination path %q: %w", file_rel, err)
+	}
+
+	var dest strings.Builder
+	err = tmpl.Execute(&dest, destPathData{RepoName: repo_name})
+	if err != nil {
+		return "", fmt.Errorf("destination path %q: %w", file_rel, err)
+	}
+
+	// E.g. a repo name containing ".." must not escape the repo root
+	if !insideRepo(dest.String()) {
+		return "", fmt.Errorf("destination path %q rendered to invalid path %q", file_rel, dest.String())
+	}
+
+	return path.Clean(dest.String()), nil
+}
+
+// resolveMappings computes the destination in repo_name of every managed
+// file. It is an error for two sources to resolve to the same destination,
+// including paths that only differ by case since they collide on case
+// insensitive filesystems.
+func resolveMappings(c *Config, repo_name string, files []string, trace *fileTrace) ([]fileMapping, error) {
+	for pattern, value := range c.Eol {
+		if value != "lf" && value != "crlf" {
+			return nil, fmt.Errorf("eol %q: must be lf or crlf, got %q", pattern, value)
+		}
+	}
+
+	exclude := c.excludeGlobs(repo_name)
+	dest_prefix := c.repoConfig(repo_name).DestPrefix
+
+	mappings := make([]fileMapping, 0, len(files))
+	for _, file := range files {
+		source_rel := managedRelPath(c.FilesDir, file)
+		dest_rel := source_rel
+		if mapped, ok := c.Mappings[source_rel]; ok {
+			dest_rel = mapped
+		}
+		file_rel, err := renderDestPath(dest_rel, repo_name)
+		if err != nil {
+			return nil, err
+		}
+
+		var template_data *fileTemplateData
+		if strings.HasSuffix(source_rel, templateSuffix) {
+			file_rel = strings.TrimSuffix(file_rel, templateSuffix)
+			template_data = &fileTemplateData{
+				RepoName: repo_name,
+				Org:      githubOrg,
+				Config:   c,
+			}
+		}
+
+		pattern, excluded := firstMatchingGlob(exclude, source_rel)
+		if !excluded {
+			pattern, excluded = firstMatchingGlob(exclude, file_rel)
+		}
+		if excluded {
+			trace.add(source_rel, "matches exclude glob %q for %s", pattern, repo_name)
+			trace.decide(source_rel, "skip (excluded)")
+			continue
+		}
+
+		mappings = append(mappings, fileMapping{
+			Source:   file,
+			Dest:     path.Join(dest_prefix, file_rel),
+			Eol:      lookupEol(c.Eol, file_rel),
+			Template: template_data,
+		})
+	}
+
+	err := checkDestinations(mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	return mappings, nil
+}
+
+func checkDestinations(mappings []fileMapping) error {
+	// Grouped by the lowercased destination, reported as mapped
+	by_dest := map[string][]fileMapping{}
+	for _, mapping := range mappings {
+		key := strings.ToLower(mapping.Dest)
+		by_dest[key] = append(by_dest[key], mapping)
+	}
+
+	var collisions []string
+	for _, group := range by_dest {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].Source < group[j].Source
+		})
+
+		var sources, dests []string
+		for _, mapping := range group {
+			sources = append(sources, mapping.Source)
+			if !slices.Contains(dests, mapping.Dest) {
+				dests = append(dests, mapping.Dest)
+			}
+		}
+
+		if len(dests) == 1 {
+			collisions = append(collisions, fmt.Sprintf(
+				"%s all map to %q", strings.Join(sources, ", "), dests[0],
+			))
+			continue
+		}
+		var quoted []string
+		for _, dest := range dests {
+			quoted = append(quoted, strconv.Quote(dest))
+		}
+		collisions = append(collisions, fmt.Sprintf(
+			"%s map to %s, which only differ by case", strings.Join(sources, ", "), strings.Join(quoted, ", "),
+		))
+	}
+
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return fmt.Errorf(
+			"duplicate destination paths: %s",
+			strings.Join(collisions, "; "),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckDestinations(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []fileMapping
+		// Substrings of the error, none for no error
+		want []string
+	}{
+		{
+			name: "distinct",
+			mappings: []fileMapping{
+				{Source: "files/a.txt", Dest: "a.txt"},
+				{Source: "files/b.txt", Dest: "b.txt"},
+			},
+		},
+		{
+			name: "same destination",
+			mappings: []fileMapping{
+				{Source: "files/a.txt", Dest: "docs/README.md"},
+				{Source: "files/b.txt", Dest: "docs/README.md"},
+			},
+			want: []string{`files/a.txt, files/b.txt all map to "docs/README.md"`},
+		},
+		{
+			name: "case only",
+			mappings: []fileMapping{
+				{Source: "files/Readme.md", Dest: "Readme.md"},
+				{Source: "files/README.md", Dest: "README.md"},
+			},
+			want: []string{
+				`files/README.md, files/Readme.md map to "README.md", "Readme.md", which only differ by case`,
+			},
+		},
+		{
+			name: "several collisions",
+			mappings: []fileMapping{
+				{Source: "files/a", Dest: "x"},
+				{Source: "files/b", Dest: "x"},
+				{Source: "files/c", Dest: "Y"},
+				{Source: "files/d", Dest: "y"},
+				{Source: "files/e", Dest: "z"},
+			},
+			want: []string{
+				`files/a, files/b all map to "x"`,
+				`files/c, files/d map to "Y", "y"`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkDestinations(test.mappings)
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Fatalf("checkDestinations() = %v, want no error", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("checkDestinations() = nil, want an error")
+			}
+			for _, want := range test.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("checkDestinations() = %q, want it to contain %q", err, want)
+				}
+			}
+			if strings.Contains(err.Error(), `"readme.md"`) {
+				t.Errorf("checkDestinations() = %q, reports the lowercased destination", err)
+			}
+		})
+	}
+}
+
+func TestRenderDestPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		file_rel  string
+		repo_name string
+		want      string
+		want_err  bool
+	}{
+		{name: "no template", file_rel: "a/../b.txt", repo_name: "x", want: "a/../b.txt"},
+		{name: "repo name", file_rel: "{{.RepoName}}.yml", repo_name: "ecsact_cli", want: "ecsact_cli.yml"},
+		{name: "cleaned", file_rel: "config/./{{.RepoName}}//a.yml", repo_name: "x", want: "config/x/a.yml"},
+		{name: "dots inside", file_rel: "a/{{.RepoName}}/../b.yml", repo_name: "x", want: "a/b.yml"},
+		{name: "empty", file_rel: "{{.RepoName}}", repo_name: "", want_err: true},
+		{name: "absolute", file_rel: "/{{.RepoName}}.yml", repo_name: "x", want_err: true},
+		{name: "parent", file_rel: "{{.RepoName}}/x.yml", repo_name: "..", want_err: true},
+		{name: "escapes", file_rel: "a/{{.RepoName}}/x.yml", repo_name: "../..", want_err: true},
+		{name: "missing key", file_rel: "{{.Missing}}.yml", repo_name: "x", want_err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := renderDestPath(test.file_rel, test.repo_name)
+			if test.want_err {
+				if err == nil {
+					t.Fatalf("renderDestPath(%q, %q) = %q, want an error", test.file_rel, test.repo_name, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderDestPath(%q, %q) failed: %v", test.file_rel, test.repo_name, err)
+			}
+			if got != test.want {
+				t.Errorf("renderDestPath(%q, %q) = %q, want %q", test.file_rel, test.repo_name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestManagedRelPath(t *testing.T) {
+	tests := []struct {
+		files_dir string
+		file      string
+		want      string
+	}{
+		{files_dir: "files", file: "files/a.txt", want: "a.txt"},
+		{files_dir: "./files", file: "files/a.txt", want: "a.txt"},
+		{files_dir: "files/", file: "files/.github/workflows/main.yml", want: ".github/workflows/main.yml"},
+		{files_dir: "/abs/files", file: "/abs/files/x", want: "x"},
+		{files_dir: ".", file: "a/b.txt", want: "a/b.txt"},
+		{files_dir: `C:\repo\files`, file: `C:\repo\files\a\b.txt`, want: "a/b.txt"},
+		{files_dir: `C:\repo\files`, file: `c:\repo\files\a.txt`, want: "a.txt"},
+		{files_dir: `C:/repo/Files`, file: `C:\repo\files\a.txt`, want: "a.txt"},
+		{files_dir: `files`, file: `files\sub\..\a.txt`, want: "a.txt"},
+		{files_dir: "files", file: "filesx/a.txt", want: "filesx/a.txt"},
+		{files_dir: "files", file: "other/a.txt", want: "other/a.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.files_dir+" "+test.file, func(t *testing.T) {
+			if got := managedRelPath(test.files_dir, test.file); got != test.want {
+				t.Errorf("managedRelPath(%q, %q) = %q, want %q", test.files_dir, test.file, got, test.want)
+			}
+		})
+	}
+}
+
+func TestConvertEol(t *testing.T) {
+	tests := []struct {
+		content string
+		eol     string
+		want    string
+	}{
+		{content: "a\nb\n", eol: "crlf", want: "a\r\nb\r\n"},
+		{content: "a\r\nb\r\n", eol: "crlf", want: "a\r\nb\r\n"},
+		{content: "a\r\nb\n", eol: "crlf", want: "a\r\nb\r\n"},
+		{content: "a\r\nb\r\n", eol: "lf", want: "a\nb\n"},
+		{content: "a\nb", eol: "lf", want: "a\nb"},
+		{content: "a\rb\n", eol: "lf", want: "a\rb\n"},
+		{content: "", eol: "crlf", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.eol+" "+strconv.Quote(test.content), func(t *testing.T) {
+			if got := string(convertEol([]byte(test.content), test.eol)); got != test.want {
+				t.Errorf("convertEol(%q, %s) = %q, want %q", test.content, test.eol, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLookupEol(t *testing.T) {
+	eol := map[string]string{
+		"*.bat":         "crlf",
+		"**/*.cmd":      "crlf",
+		"scripts/*":     "lf",
+		"scripts/*.bat": "lf",
+	}
+	tests := []struct {
+		dest string
+		want string
+	}{
+		{dest: "build.bat", want: "crlf"},
+		{dest: "tools/run.cmd", want: "crlf"},
+		{dest: "scripts/x.sh", want: "lf"},
+		// The longest matching glob wins
+		{dest: "scripts/x.bat", want: "lf"},
+		{dest: "README.md", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dest, func(t *testing.T) {
+			if got := lookupEol(eol, test.dest); got != test.want {
+				t.Errorf("lookupEol(%q) = %q, want %q", test.dest, got, test.want)
+			}
+		})
+	}
+}
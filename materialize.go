@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// materialize writes the managed files exactly as they would be synced to
+// repo_name into out_dir, those of every set in sets syncing to it, without
+// any git or PR work.
+func materialize(sets []*Config, set_files [][]string, repo_name string, out_dir string) error {
+	count := 0
+	found := false
+	for i, c := range sets {
+		if !slices.Contains(c.Repos, repo_name) {
+			continue
+		}
+		found = true
+
+		mappings, err := resolveMappings(c, repo_name, filesForRepo(c, set_files[i], repo_name, nil), nil)
+		if err != nil {
+			return err
+		}
+
+		files_diff := &FilesDiff{Mappings: map[string]fileMapping{}}
+		for _, mapping := range mappings {
+			files_diff.NewFiles = append(files_diff.NewFiles, mapping.Dest)
+			files_diff.Mappings[mapping.Dest] = mapping
+		}
+
+		err = copyFiles(files_diff, out_dir, files_diff.NewFiles)
+		if err != nil {
+			return err
+		}
+		count += len(files_diff.NewFiles)
+	}
+	if !found {
+		return fmt.Errorf("-materialize: %q is not in the config repos", repo_name)
+	}
+
+	logInfo("Materialized %d files for %s in %s", count, repo_name, out_dir)
+	return nil
+}
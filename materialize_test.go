@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMaterialize(t *testing.T) {
+	dir := t.TempDir()
+	ci_dir := filepath.Join(dir, "ci")
+	editor_dir := filepath.Join(dir, "editor")
+	writeTestFile(t, filepath.Join(ci_dir, ".github", "workflows", "main.yml"), "on: push\n", 0644)
+	writeTestFile(t, filepath.Join(editor_dir, ".editorconfig"), "root = true\n", 0644)
+
+	c := &Config{
+		Repos: []string{"ecsact_cli"},
+		SyncSets: []SyncSet{
+			{Name: "ci", FilesDir: ci_dir},
+			{Name: "editor", FilesDir: editor_dir, Tiers: []string{"core"}},
+		},
+	}
+	// Discovered repos are materialized like configured ones
+	mergeInventory(c, []InventoryRepo{{Name: "ecsact_runtime", Tier: "core"}})
+
+	sets, err := c.syncSetConfigs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set_files := make([][]string, len(sets))
+	for i, set_config := range sets {
+		set_files[i], err = managedFiles(set_config, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		repo_name string
+		want      []string
+		want_err  bool
+	}{
+		{repo_name: "ecsact_cli", want: []string{".github/workflows/main.yml"}},
+		{repo_name: "ecsact_runtime", want: []string{".editorconfig", ".github/workflows/main.yml"}},
+		{repo_name: "ecsact_lsp", want_err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.repo_name, func(t *testing.T) {
+			out_dir := filepath.Join(t.TempDir(), "out")
+			err := materialize(sets, set_files, test.repo_name, out_dir)
+			if test.want_err {
+				if err == nil {
+					t.Fatal("materialize() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("materialize() failed: %v", err)
+			}
+
+			var got []string
+			err = filepath.WalkDir(out_dir, func(file string, entry os.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() {
+					file_rel, _ := filepath.Rel(out_dir, file)
+					got = append(got, filepath.ToSlash(file_rel))
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("materialize() wrote %v, want %v", got, test.want)
+			}
+		})
+	}
+}
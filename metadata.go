@@ -0,0 +1,53 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// Globs of the files written by the sync itself, such as the manifest and
+// snapshots. Changes to these alone never warrant a sync PR.
+var defaultMetadataPaths = []string{
+	".ecsact-common-manifest*.json",
+	".ecsact-common/**",
+}
+
+// metadataPaths returns the default metadata globs and metadata_paths.
+func (c *Config) metadataPaths() []string {
+	return append(slices.Clone(defaultMetadataPaths), c.MetadataPaths...)
+}
+
+// onlyMetadata reports whether files is non empty and each of its paths
+// matches a metadata glob of c.
+func onlyMetadata(c *Config, files []string) bool {
+	if len(files) == 0 {
+		return false
+	}
+
+	patterns := c.metadataPaths()
+	for _, file_rel := range files {
+		if !matchAnyGlob(patterns, file_rel) {
+			return false
+		}
+	}
+	return true
+}
+
+// changedPaths returns the paths with uncommitted changes in worktree,
+// untracked files included.
+func changedPaths(worktree *git.Worktree) ([]string, error) {
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for file_rel, file_status := range status {
+		if file_status.Staging != git.Unmodified || file_status.Worktree != git.Unmodified {
+			paths = append(paths, file_rel)
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+)
+
+// filterModifiedFiles warns about the changed files of files_diff that were
+// edited in the repo since they were last synced, i.e. their content matches
+// neither the managed file nor the hash recorded in manifest. With
+// -skip-modified they are removed from files_diff instead of overwritten.
+func filterModifiedFiles(repo_name, repo_dir string, manifest map[string]repoManifestFile, files_diff *FilesDiff, trace *fileTrace) error {
+	keep := func(file_rel string) (bool, error) {
+		synced, ok := manifest[file_rel]
+		// Content around a managed block belongs to the repo
+		if !ok || synced.Sha256 == "" || files_diff.Mappings[file_rel].BlockTarget != "" {
+			return true, nil
+		}
+
+		content, err := os.ReadFile(path.Join(repo_dir, file_rel))
+		if err != nil {
+			return false, err
+		}
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) == synced.Sha256 {
+			return true, nil
+		}
+
+		trace.add(file_rel, "edited in repo since the last sync")
+		if *skipModified {
+			trace.decide(file_rel, "skip (modified in repo)")
+			logWarn("%s edited %s since it was last synced, not overwriting it", repo_name, file_rel)
+			return false, nil
+		}
+		logWarn(
+			"%s edited %s since it was last synced, the sync overwrites these edits (use -skip-modified to keep them)",
+			repo_name, file_rel,
+		)
+		return true, nil
+	}
+
+	var err error
+	files_diff.ChangedFiles, err = filterFiles(files_diff.ChangedFiles, keep)
+	return err
+}
@@ -0,0 +1,9 @@
+package main
+
+// GitHub org every repo belongs to, set from the org config in main()
+var githubOrg = "ecsact-dev"
+
+// orgRepo returns the owner/name of repo_name as used by gh and the GitHub API.
+func orgRepo(repo_name string) string {
+	return githubOrg + "/" + repo_name
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writePatch writes the changes files_diff makes to the clone in repo_dir as
+// a git style patch to <patch_dir>/<repo_name>.patch, suffixed with the sync
+// set name with sync_sets. Binary files are left out so the patch applies
+// with git apply.
+func writePatch(patch_dir string, c *Config, repo_name string, repo_dir string, files_diff *FilesDiff) error {
+	var patch strings.Builder
+
+	for _, file_rel := range files_diff.NewFiles {
+		mapping := files_diff.Mappings[file_rel]
+		content, err := mapping.render()
+		if err != nil {
+			return err
+		}
+		stat, err := os.Stat(mapping.Source)
+		if err != nil {
+			return err
+		}
+
+		if isBinary(content) {
+			continue
+		}
+		fmt.Fprintf(&patch, "diff --git a/%s b/%s\n", file_rel, file_rel)
+		fmt.Fprintf(&patch, "new file mode 100%o\n", gitFileMode(stat.Mode()))
+		patch.WriteString(unifiedDiff("/dev/null", "b/"+file_rel, "", string(content)))
+	}
+
+	for _, file_rel := range files_diff.ChangedFiles {
+		content, err := files_diff.Mappings[file_rel].render()
+		if err != nil {
+			return err
+		}
+		repo_content, err := os.ReadFile(filepath.Join(repo_dir, file_rel))
+		if err != nil {
+			return err
+		}
+
+		if isBinary(repo_content) || isBinary(content) {
+			continue
+		}
+		fmt.Fprintf(&patch, "diff --git a/%s b/%s\n", file_rel, file_rel)
+		patch.WriteString(unifiedDiff("a/"+file_rel, "b/"+file_rel, string(repo_content), string(content)))
+	}
+
+	for _, file_rel := range files_diff.DeletedFiles {
+		repo_path := filepath.Join(repo_dir, file_rel)
+		repo_content, err := os.ReadFile(repo_path)
+		if err != nil {
+			return err
+		}
+		stat, err := os.Stat(repo_path)
+		if err != nil {
+			return err
+		}
+
+		if isBinary(repo_content) {
+			continue
+		}
+		fmt.Fprintf(&patch, "diff --git a/%s b/%s\n", file_rel, file_rel)
+		fmt.Fprintf(&patch, "deleted file mode 100%o\n", gitFileMode(stat.Mode()))
+		patch.WriteString(unifiedDiff("a/"+file_rel, "/dev/null", string(repo_content), ""))
+	}
+
+	name := repo_name
+	if c.SetName != "" {
+		name += "-" + c.SetName
+	}
+
+	err := os.MkdirAll(patch_dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	patch_file := filepath.Join(patch_dir, name+".patch")
+	err = os.WriteFile(patch_file, []byte(patch.String()), 0644)
+	if err != nil {
+		return err
+	}
+	logVerbose("wrote %s", patch_file)
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// runPostSyncCommands runs each of commands with sh in repo_dir once the
+// synced files are written, e.g. to format them. The first failing command
+// fails the sync of the repo.
+func runPostSyncCommands(commands []string, repo_dir string) error {
+	for _, command := range commands {
+		cmd := exec.CommandContext(runCtx, "sh", "-c", command)
+		cmd.Dir = repo_dir
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("post sync command %q: %w", command, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// defaultPrBody links to the configured org's ecsact_common repo
+func defaultPrBody() string {
+	return "Automatically created by https://github.com/" + orgRepo("ecsact_common")
+}
+
+// Maximum PR body size accepted by GitHub
+const defaultPrBodyMaxSize = 65536
+
+// Fence languages for new files shown in the PR body, by file extension
+var fenceLanguages = map[string]string{
+	".bazel":   "starlark",
+	".bazelrc": "sh",
+	".bzl":     "starlark",
+	".c":       "c",
+	".cc":      "cpp",
+	".cpp":     "cpp",
+	".cs":      "csharp",
+	".go":      "go",
+	".h":       "c",
+	".hh":      "cpp",
+	".hpp":     "cpp",
+	".json":    "json",
+	".md":      "markdown",
+	".sh":      "sh",
+	".toml":    "toml",
+	".ts":      "typescript",
+	".yaml":    "yaml",
+	".yml":     "yaml",
+}
+
+// prBodyDiff is the collapsible section of the PR body showing one file.
+type prBodyDiff struct {
+	File    string
+	Lang    string
+	Content string
+	Omitted bool
+}
+
+func (d *prBodyDiff) String() string {
+	if d.Omitted {
+		return fmt.Sprintf(
+			"<details><summary>%s</summary>\n\nDiff too large to include.\n\n</details>",
+			d.File,
+		)
+	}
+
+	fence := codeFence(d.Content)
+	return fmt.Sprintf(
+		"<details><summary>%s</summary>\n\n%s%s\n%s\n%s\n\n</details>",
+		d.File, fence, d.Lang, strings.TrimSuffix(d.Content, "\n"), fence,
+	)
+}
+
+// codeFence returns a backtick fence longer than any backtick run in content.
+func codeFence(content string) string {
+	longest := 0
+	run := 0
+	for _, r := range content {
+		if r == '`' {
+			run += 1
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// fenceLanguage picks the code fence language for a file section. New files
+// are shown in full and highlighted by their extension, everything else is a
+// diff.
+func fenceLanguage(file_rel string, content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "@@ ") {
+			return "diff"
+		}
+	}
+	return fenceLanguages[path.Ext(file_rel)]
+}
+
+// prBodyDiffs creates a section for every new and changed text file, comparing
+// the managed file against the repo's current file in repo_dir.
+func prBodyDiffs(
+	repo_dir string,
+	files_diff *FilesDiff,
+) ([]*prBodyDiff, error) {
+	var diffs []*prBodyDiff
+
+	for _, file_rel := range files_diff.NewFiles {
+		content, err := files_diff.Mappings[file_rel].render()
+		if err != nil {
+			return nil, err
+		}
+		if isBinary(content) {
+			continue
+		}
+
+		diffs = append(diffs, &prBodyDiff{
+			File:    file_rel,
+			Lang:    fenceLanguage(file_rel, string(content)),
+			Content: string(content),
+		})
+	}
+
+	for _, file_rel := range files_diff.ChangedFiles {
+		template_content, err := files_diff.Mappings[file_rel].render()
+		if err != nil {
+			return nil, err
+		}
+		repo_content, err := os.ReadFile(repo_dir + "/" + file_rel)
+		if err != nil {
+			return nil, err
+		}
+		if isBinary(template_content) || isBinary(repo_content) {
+			continue
+		}
+
+		content := unifiedDiff(
+			"a/"+file_rel,
+			"b/"+file_rel,
+			string(repo_content),
+			string(template_content),
+		)
+		diffs = append(diffs, &prBodyDiff{
+			File:    file_rel,
+			Lang:    fenceLanguage(file_rel, content),
+			Content: content,
+		})
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].File < diffs[j].File
+	})
+
+	return diffs, nil
+}
+
+// joinPrBodyDiffs appends diffs to body, omitting the largest diffs first
+// until the result fits in max_size. When even the omitted sections don't
+// fit, the last sections are dropped whole in favor of a note.
+func joinPrBodyDiffs(body string, diffs []*prBodyDiff, max_size int) string {
+	join := func(count int) string {
+		parts := []string{body}
+		for _, d := range diffs[:count] {
+			parts = append(parts, d.String())
+		}
+		return strings.Join(parts, "\n\n")
+	}
+
+	result := join(len(diffs))
+	for len(result) > max_size {
+		var largest *prBodyDiff
+		for _, d := range diffs {
+			if !d.Omitted && (largest == nil || len(d.Content) > len(largest.Content)) {
+				largest = d
+			}
+		}
+		if largest == nil {
+			break
+		}
+
+		largest.Omitted = true
+		result = join(len(diffs))
+	}
+	if len(result) <= max_size {
+		return result
+	}
+
+	for count := len(diffs) - 1; count >= 0; count-- {
+		result = join(count) + fmt.Sprintf("\n\n%d more files omitted.", len(diffs)-count)
+		if len(result) <= max_size {
+			return result
+		}
+	}
+
+	// Not even the body fits with the note, cut it without splitting a rune
+	if len(body) <= max_size {
+		return body
+	}
+	cut := max_size
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return body[:cut]
+}
+
+// prBody builds the PR body for files_diff. It starts with the rendered
+// pr_body, or the default body without one, followed by the rendered body of
+// the dominant change category and every configured fragment whose paths
+// match a new or changed file. Must be called before the managed files are
+// copied into repo_dir.
+func prBody(c *Config, repo_name string, source_sha string, repo_dir string, files_diff *FilesDiff) (string, error) {
+	body := defaultPrBody()
+	if c.PrBody != "" {
+		var err error
+		body, err = renderPrBody("pr_body", c.PrBody, repo_name, source_sha, files_diff)
+		if err != nil {
+			return "", err
+		}
+	}
+	if category := dominantCategory(c.ChangeCategories, files_diff); category != nil && category.Body != "" {
+		category_body, err := renderPrBody("change_categories "+category.Name, category.Body, repo_name, source_sha, files_diff)
+		if err != nil {
+			return "", err
+		}
+		body += "\n\n" + category_body
+	}
+
+	for _, fragment := range c.PrBodyFragments {
+		if fragmentMatches(fragment, files_diff) {
+			body += "\n\n" + strings.TrimSpace(fragment.Body)
+		}
+	}
+
+	if c.PrBodyChecksums {
+		body += "\n\n" + checksumTable(files_diff)
+	}
+
+	if c.PrBodyDiffs {
+		diffs, err := prBodyDiffs(repo_dir, files_diff)
+		if err != nil {
+			return "", err
+		}
+
+		max_size := c.PrBodyMaxSize
+		if max_size <= 0 {
+			max_size = defaultPrBodyMaxSize
+		}
+		body = joinPrBodyDiffs(body, diffs, max_size)
+	}
+
+	return body, nil
+}
+
+// prBodyData is available to the pr_body and change category body templates.
+type prBodyData struct {
+	RepoName       string
+	Org            string
+	SourceSha      string
+	SourceShortSha string
+	// Link to the ecsact_common commit synced from, empty if unknown
+	SourceUrl string
+	FilesDiff *FilesDiff
+}
+
+// renderPrBody renders the PR body template text named name for repo_name.
+func renderPrBody(name string, text string, repo_name string, source_sha string, files_diff *FilesDiff) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	data := prBodyData{
+		RepoName:  repo_name,
+		Org:       githubOrg,
+		SourceSha: source_sha,
+		FilesDiff: files_diff,
+	}
+	if source_sha != "" {
+		data.SourceShortSha = source_sha[:min(7, len(source_sha))]
+		data.SourceUrl = fmt.Sprintf("https://github.com/%s/commit/%s", orgRepo("ecsact_common"), source_sha)
+	}
+
+	var body strings.Builder
+	err = tmpl.Execute(&body, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(body.String()), nil
+}
+
+// checksumTable is a markdown table of the sha256 of every new and changed
+// file so the synced content can be verified against the source.
+func checksumTable(files_diff *FilesDiff) string {
+	files := append(slices.Clone(files_diff.NewFiles), files_diff.ChangedFiles...)
+	sort.Strings(files)
+
+	var table strings.Builder
+	table.WriteString("| File | SHA-256 |\n")
+	table.WriteString("| --- | --- |\n")
+	for _, file_rel := range files {
+		fmt.Fprintf(&table, "| `%s` | `%s` |\n", file_rel, files_diff.Hashes[file_rel])
+	}
+
+	return strings.TrimSuffix(table.String(), "\n")
+}
+
+func fragmentMatches(fragment PrBodyFragment, files_diff *FilesDiff) bool {
+	for _, files := range [][]string{files_diff.NewFiles, files_diff.ChangedFiles} {
+		for _, file := range files {
+			if matchAnyGlob(fragment.Paths, file) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPrBodyCategory(t *testing.T) {
+	files_diff := &FilesDiff{
+		NewFiles:     []string{".github/workflows/main.yml"},
+		ChangedFiles: []string{".github/workflows/release.yml", ".editorconfig"},
+	}
+	categories := []ChangeCategory{
+		{Name: "editor", Paths: []string{".editorconfig"}, Body: "Editor config"},
+		{Name: "ci", Paths: []string{".github/**"}, Body: "CI changes for {{.RepoName}}"},
+	}
+
+	tests := []struct {
+		name string
+		c    *Config
+		want string
+	}{
+		{
+			name: "default body",
+			c:    &Config{ChangeCategories: categories},
+			want: defaultPrBody() + "\n\nCI changes for ecsact_cli",
+		},
+		{
+			name: "pr_body",
+			c: &Config{
+				PrBody:           "Synced from {{.SourceShortSha}}",
+				ChangeCategories: categories,
+			},
+			want: "Synced from 0123456\n\nCI changes for ecsact_cli",
+		},
+		{
+			name: "no matching category",
+			c: &Config{
+				PrBody:           "Synced",
+				ChangeCategories: []ChangeCategory{{Name: "docs", Paths: []string{"*.md"}, Body: "Docs"}},
+			},
+			want: "Synced",
+		},
+		{
+			name: "category without body",
+			c: &Config{
+				PrBody:           "Synced",
+				ChangeCategories: []ChangeCategory{{Name: "ci", Paths: []string{".github/**"}}},
+			},
+			want: "Synced",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := prBody(test.c, "ecsact_cli", "0123456789abcdef", t.TempDir(), files_diff)
+			if err != nil {
+				t.Fatalf("prBody() failed: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("prBody() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrBodyCategoryInvalidTemplate(t *testing.T) {
+	c := &Config{ChangeCategories: []ChangeCategory{{Name: "all", Paths: []string{"*"}, Body: "{{.Missing"}}}
+	files_diff := &FilesDiff{NewFiles: []string{"a.txt"}}
+
+	_, err := prBody(c, "ecsact_cli", "", t.TempDir(), files_diff)
+	if err == nil {
+		t.Fatal("prBody() = nil, want a template error")
+	}
+}
+
+func TestPrBodyDiffString(t *testing.T) {
+	tests := []struct {
+		name string
+		diff prBodyDiff
+		want string
+	}{
+		{
+			name: "new file",
+			diff: prBodyDiff{File: "a.yml", Lang: "yaml", Content: "on: push\n"},
+			want: "<details><summary>a.yml</summary>\n\n```yaml\non: push\n```\n\n</details>",
+		},
+		{
+			name: "backticks in content",
+			diff: prBodyDiff{File: "README.md", Lang: "markdown", Content: "```sh\nls\n```"},
+			want: "<details><summary>README.md</summary>\n\n````markdown\n```sh\nls\n```\n````\n\n</details>",
+		},
+		{
+			name: "omitted",
+			diff: prBodyDiff{File: "big.txt", Content: "x", Omitted: true},
+			want: "<details><summary>big.txt</summary>\n\nDiff too large to include.\n\n</details>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.diff.String(); got != test.want {
+				t.Errorf("String() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestJoinPrBodyDiffs(t *testing.T) {
+	newDiffs := func() []*prBodyDiff {
+		return []*prBodyDiff{
+			{File: "a.txt", Content: strings.Repeat("a", 10)},
+			{File: "b.txt", Content: strings.Repeat("b", 200)},
+			{File: "c.txt", Content: strings.Repeat("c", 50)},
+		}
+	}
+	full := joinPrBodyDiffs("Body", newDiffs(), defaultPrBodyMaxSize)
+
+	tests := []struct {
+		name     string
+		body     string
+		max_size int
+		// Substrings the result must and must not contain
+		want     []string
+		not_want []string
+	}{
+		{
+			name:     "fits",
+			body:     "Body",
+			max_size: len(full),
+			want:     []string{"Body\n\n<details><summary>a.txt", "aaaa", "bbbb", "cccc"},
+		},
+		{
+			name:     "largest omitted first",
+			body:     "Body",
+			max_size: len(full) - 1,
+			want:     []string{"aaaa", "cccc", "Diff too large to include."},
+			not_want: []string{"bbbb"},
+		},
+		{
+			name:     "sections dropped",
+			body:     "Body",
+			max_size: 200,
+			want:     []string{"Body", "more files omitted."},
+			not_want: []string{"aaaa", "bbbb", "cccc", "<summary>c.txt"},
+		},
+		{
+			name:     "body only",
+			body:     "Body",
+			max_size: 30,
+			want:     []string{"Body\n\n3 more files omitted."},
+			not_want: []string{"<details>"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := joinPrBodyDiffs(test.body, newDiffs(), test.max_size)
+			if len(got) > test.max_size {
+				t.Errorf("joinPrBodyDiffs() is %d bytes, want at most %d", len(got), test.max_size)
+			}
+			if strings.Count(got, "<details>") != strings.Count(got, "</details>") {
+				t.Errorf("joinPrBodyDiffs() = %q, has an unclosed section", got)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("joinPrBodyDiffs() = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, not_want := range test.not_want {
+				if strings.Contains(got, not_want) {
+					t.Errorf("joinPrBodyDiffs() = %q, want it not to contain %q", got, not_want)
+				}
+			}
+		})
+	}
+}
+
+func TestJoinPrBodyDiffsCutsBodyAtRunes(t *testing.T) {
+	body := strings.Repeat("é", 20)
+	got := joinPrBodyDiffs(body, []*prBodyDiff{{File: "a.txt", Content: "a"}}, 15)
+	if !utf8.ValidString(got) {
+		t.Errorf("joinPrBodyDiffs() = %q, splits a rune", got)
+	}
+	if len(got) > 15 || len(got) < 14 {
+		t.Errorf("joinPrBodyDiffs() is %d bytes, want 14", len(got))
+	}
+}
+
+func TestFragmentMatches(t *testing.T) {
+	fragment := PrBodyFragment{Paths: []string{".github/workflows/*.yml"}, Body: "Security"}
+	tests := []struct {
+		name       string
+		files_diff *FilesDiff
+		want       bool
+	}{
+		{name: "new workflow", files_diff: &FilesDiff{NewFiles: []string{".github/workflows/main.yml"}}, want: true},
+		{name: "changed workflow", files_diff: &FilesDiff{ChangedFiles: []string{"README.md", ".github/workflows/ci.yml"}}, want: true},
+		{name: "docs only", files_diff: &FilesDiff{ChangedFiles: []string{"docs/index.md", "README.md"}}, want: false},
+		{name: "deleted workflow", files_diff: &FilesDiff{DeletedFiles: []string{".github/workflows/old.yml"}}, want: false},
+		{name: "nested", files_diff: &FilesDiff{NewFiles: []string{".github/workflows/sub/x.yml"}}, want: false},
+		{name: "nothing", files_diff: &FilesDiff{}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := fragmentMatches(fragment, test.files_diff); got != test.want {
+				t.Errorf("fragmentMatches() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrBodyFragments(t *testing.T) {
+	c := &Config{
+		PrBody: "Synced",
+		PrBodyFragments: []PrBodyFragment{
+			{Paths: []string{".github/workflows/*"}, Body: "  **Security:** workflows changed, please review.\n"},
+			{Paths: []string{"*.md", "docs/**"}, Body: "Docs changed."},
+		},
+	}
+	tests := []struct {
+		name       string
+		files_diff *FilesDiff
+		want       string
+	}{
+		{
+			name:       "workflow change",
+			files_diff: &FilesDiff{ChangedFiles: []string{".github/workflows/main.yml"}},
+			want:       "Synced\n\n**Security:** workflows changed, please review.",
+		},
+		{
+			name:       "docs only",
+			files_diff: &FilesDiff{NewFiles: []string{"docs/guide.md"}},
+			want:       "Synced\n\nDocs changed.",
+		},
+		{
+			name:       "both in order",
+			files_diff: &FilesDiff{NewFiles: []string{"README.md"}, ChangedFiles: []string{".github/workflows/main.yml"}},
+			want:       "Synced\n\n**Security:** workflows changed, please review.\n\nDocs changed.",
+		},
+		{name: "neither", files_diff: &FilesDiff{ChangedFiles: []string{".editorconfig"}}, want: "Synced"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := prBody(c, "ecsact_cli", "", t.TempDir(), test.files_diff)
+			if err != nil {
+				t.Fatalf("prBody() failed: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("prBody() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestChecksumTable(t *testing.T) {
+	header := "| File | SHA-256 |\n| --- | --- |"
+
+	tests := []struct {
+		name       string
+		files_diff *FilesDiff
+		want       string
+	}{
+		{name: "no files", files_diff: &FilesDiff{}, want: header},
+		{
+			name: "sorted",
+			files_diff: &FilesDiff{
+				NewFiles:     []string{"b.txt"},
+				ChangedFiles: []string{"a.txt"},
+				DeletedFiles: []string{"c.txt"},
+				Hashes:       map[string]string{"a.txt": "aaaa", "b.txt": "bbbb"},
+			},
+			want: header + "\n| `a.txt` | `aaaa` |\n| `b.txt` | `bbbb` |",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := checksumTable(test.files_diff); got != test.want {
+				t.Errorf("checksumTable() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// PrClient is the backend used to look up repos and to find, create and auto
+// merge sync PRs.
+type PrClient interface {
+	// FindPr returns the number of the open PR from branch titled title by
+	// author, or nil if there isn't one
+	FindPr(repo string, branch string, title string, author string) (*int, error)
+	// CreatePr returns the number and URL of the created PR
+	CreatePr(repo string, branch string, base string, title string, body string) (int, string, error)
+	EnableAutoMerge(repo string, branch string) error
+	RequestReviewers(repo string, pr_num int, reviewers []string) error
+	AddLabel(repo string, pr_num int, label string) error
+	AddAssignees(repo string, pr_num int, assignees []string) error
+	ViewPrBody(repo string, pr_num int) (string, error)
+	ViewPrUrl(repo string, pr_num int) (string, error)
+	EditPrBody(repo string, pr_num int, body string) error
+	// UnresolvedReviewThreads counts the unresolved review threads of a PR
+	UnresolvedReviewThreads(repo string, pr_num int) (int, error)
+	// ViewRepo returns whether repo is archived or disabled and its default
+	// branch
+	ViewRepo(repo string) (repoView, error)
+}
+
+// repoView is the state of a repo that decides if and where it's synced.
+type repoView struct {
+	Archived      bool
+	Disabled      bool
+	DefaultBranch string
+}
+
+// PR backend used by the sync. A variable so it can be replaced, e.g. by a
+// local fake.
+var prClient PrClient = ghCliPrClient{}
+
+// ghCliPrClient implements PrClient by running the gh CLI.
+type ghCliPrClient struct{}
+
+func (ghCliPrClient) FindPr(repo string, branch string, title string, author string) (*int, error) {
+	output, err := runGh(
+		"pr", "list",
+		"-R", orgRepo(repo),
+		"--json=title,number,author,headRefName",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return findPrInList(output, branch, title, author)
+}
+
+// findPrInList returns the number of the PR from branch titled title by
+// author in the output of `gh pr list`, or nil if there isn't one.
+func findPrInList(output []byte, branch string, title string, author string) (*int, error) {
+	// Unlike the other fields gh names the bot flag of authors in snake case
+	type PrAuthor struct {
+		IsBot bool   `json:"is_bot"`
+		Login string `json:"login"`
+	}
+
+	type PrListItem struct {
+		Author      PrAuthor `json:"author"`
+		Number      int      `json:"number"`
+		Title       string   `json:"title"`
+		HeadRefName string   `json:"headRefName"`
+	}
+
+	var items []PrListItem
+	err := json.Unmarshal(output, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if item.Author.Login != author {
+			continue
+		}
+		if item.Title != title {
+			continue
+		}
+		if item.HeadRefName != branch {
+			continue
+		}
+
+		return &item.Number, nil
+	}
+
+	return nil, nil
+}
+
+func (ghCliPrClient) CreatePr(repo string, branch string, base string, title string, body string) (int, string, error) {
+	output, err := runGh(
+		"pr", "create",
+		"-R", orgRepo(repo),
+		"-t", title,
+		"-b", body,
+		"-H", branch,
+		"-B", base,
+	)
+	if err != nil {
+		// An open PR from branch that FindPr didn't match, e.g. because its
+		// title was changed. gh includes its URL in the error message.
+		if match := existingPrUrlRegexp.FindStringSubmatch(err.Error()); match != nil {
+			logInfo("Reusing existing PR %s", match[1])
+			pr_num, err := parsePrUrlNumber(match[1])
+			return pr_num, match[1], err
+		}
+		return 0, "", err
+	}
+	pr_url := strings.TrimSpace(string(output))
+	logInfo("%s", pr_url)
+
+	pr_num, err := parsePrUrlNumber(pr_url)
+	return pr_num, pr_url, err
+}
+
+var existingPrUrlRegexp = regexp.MustCompile(`already exists[^\n]*?(https://\S+/pull/\d+)`)
+
+func (ghCliPrClient) EnableAutoMerge(repo string, branch string) error {
+	if !ghVariant.AutoMerge {
+		return nil
+	}
+
+	output, err := runGh(
+		"pr", "merge", branch, "--auto",
+		"-R", orgRepo(repo),
+	)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(output)) > 0 {
+		logInfo("%s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (ghCliPrClient) RequestReviewers(repo string, pr_num int, reviewers []string) error {
+	_, err := runGh(
+		"pr", "edit", fmt.Sprint(pr_num),
+		"-R", orgRepo(repo),
+		"--add-reviewer", strings.Join(reviewers, ","),
+	)
+	return err
+}
+
+func (ghCliPrClient) AddLabel(repo string, pr_num int, label string) error {
+	_, err := runGh(
+		"pr", "edit", fmt.Sprint(pr_num),
+		"-R", orgRepo(repo),
+		"--add-label", label,
+	)
+	return err
+}
+
+func (ghCliPrClient) AddAssignees(repo string, pr_num int, assignees []string) error {
+	_, err := runGh(
+		"pr", "edit", fmt.Sprint(pr_num),
+		"-R", orgRepo(repo),
+		"--add-assignee", strings.Join(assignees, ","),
+	)
+	return err
+}
+
+func (ghCliPrClient) ViewPrBody(repo string, pr_num int) (string, error) {
+	output, err := runGh(
+		"pr", "view", fmt.Sprint(pr_num),
+		"-R", orgRepo(repo),
+		"--json=body",
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var pr struct {
+		Body string `json:"body"`
+	}
+	err = json.Unmarshal(output, &pr)
+	return pr.Body, err
+}
+
+func (ghCliPrClient) ViewPrUrl(repo string, pr_num int) (string, error) {
+	output, err := runGh(
+		"pr", "view", fmt.Sprint(pr_num),
+		"-R", orgRepo(repo),
+		"--json=url",
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var pr struct {
+		Url string `json:"url"`
+	}
+	err = json.Unmarshal(output, &pr)
+	return pr.Url, err
+}
+
+func (ghCliPrClient) EditPrBody(repo string, pr_num int, body string) error {
+	_, err := runGh(
+		"pr", "edit", fmt.Sprint(pr_num),
+		"-R", orgRepo(repo),
+		"-b", body,
+	)
+	return err
+}
+
+func (ghCliPrClient) ViewRepo(repo string) (repoView, error) {
+	output, err := runGh(
+		"repo", "view", orgRepo(repo),
+		"--json", "isArchived,isDisabled,defaultBranchRef",
+	)
+	if err != nil {
+		return repoView{}, err
+	}
+
+	var view struct {
+		IsArchived       bool `json:"isArchived"`
+		IsDisabled       bool `json:"isDisabled"`
+		DefaultBranchRef struct {
+			Name string `json:"name"`
+		} `json:"defaultBranchRef"`
+	}
+	err = json.Unmarshal(output, &view)
+	if err != nil {
+		return repoView{}, fmt.Errorf("parsing repo view of %s: %w", repo, err)
+	}
+	return repoView{
+		Archived:      view.IsArchived,
+		Disabled:      view.IsDisabled,
+		DefaultBranch: view.DefaultBranchRef.Name,
+	}, nil
+}
+
+// prWebUrl is the URL of PR pr_num of repo_name on GitHub.
+func prWebUrl(repo_name string, pr_num int) string {
+	return fmt.Sprintf("https://github.com/%s/pull/%d", orgRepo(repo_name), pr_num)
+}
+
+// parsePrUrlNumber parses the PR number from the PR URL printed by
+// `gh pr create`.
+func parsePrUrlNumber(output string) (int, error) {
+	url := strings.TrimSpace(output)
+	var pr_num int
+	_, err := fmt.Sscanf(path.Base(url), "%d", &pr_num)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected gh pr create output %q", output)
+	}
+	return pr_num, nil
+}
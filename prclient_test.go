@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestFindPrInList(t *testing.T) {
+	const (
+		branch = "chore/sync-with-ecsact-common"
+		title  = "chore: sync with ecsact_common"
+		author = "seaubot"
+	)
+
+	tests := []struct {
+		name     string
+		output   string
+		want     int
+		want_err bool
+	}{
+		{name: "no PRs", output: `[]`},
+		{
+			name: "match",
+			output: `[
+				{"author":{"is_bot":false,"login":"someone"},"number":3,"title":"feat: x","headRefName":"feat"},
+				{"author":{"id":"U_1","is_bot":true,"login":"seaubot","name":""},"number":7,"title":"chore: sync with ecsact_common","headRefName":"chore/sync-with-ecsact-common"}
+			]`,
+			want: 7,
+		},
+		{
+			name:   "other author",
+			output: `[{"author":{"login":"someone"},"number":7,"title":"chore: sync with ecsact_common","headRefName":"chore/sync-with-ecsact-common"}]`,
+		},
+		{
+			name:   "other title",
+			output: `[{"author":{"login":"seaubot"},"number":7,"title":"chore: sync","headRefName":"chore/sync-with-ecsact-common"}]`,
+		},
+		{
+			name:   "other branch",
+			output: `[{"author":{"login":"seaubot"},"number":7,"title":"chore: sync with ecsact_common","headRefName":"chore/sync"}]`,
+		},
+		{
+			name: "first match",
+			output: `[
+				{"author":{"login":"seaubot"},"number":9,"title":"chore: sync with ecsact_common","headRefName":"chore/sync-with-ecsact-common"},
+				{"author":{"login":"seaubot"},"number":8,"title":"chore: sync with ecsact_common","headRefName":"chore/sync-with-ecsact-common"}
+			]`,
+			want: 9,
+		},
+		{name: "invalid", output: `[{"number":`, want_err: true},
+		{name: "not a list", output: `{"number":7}`, want_err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := findPrInList([]byte(test.output), branch, title, author)
+			if test.want_err {
+				if err == nil {
+					t.Fatalf("findPrInList() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findPrInList() failed: %v", err)
+			}
+
+			if test.want == 0 {
+				if got != nil {
+					t.Errorf("findPrInList() = #%d, want none", *got)
+				}
+				return
+			}
+			if got == nil || *got != test.want {
+				t.Errorf("findPrInList() = %v, want #%d", got, test.want)
+			}
+		})
+	}
+}
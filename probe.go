@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// probeCommand returns the probe configured for repo_name, preferring a per
+// repo probe over the global one.
+func probeCommand(c *Config, repo_name string) []string {
+	if probe, ok := c.RepoProbes[repo_name]; ok {
+		return probe
+	}
+	return c.Probe
+}
+
+// runProbe runs probe in repo_dir and reports whether it exited zero. Failing
+// to run the probe at all is an error.
+func runProbe(probe []string, repo_dir string) (bool, error) {
+	if len(probe) == 0 {
+		return true, nil
+	}
+
+	cmd := exec.CommandContext(runCtx, probe[0], probe[1:]...)
+	cmd.Dir = repo_dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if runCtx.Err() != nil {
+		return false, runCtx.Err()
+	}
+	var exit_err *exec.ExitError
+	if errors.As(err, &exit_err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
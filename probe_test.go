@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunProbe(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("the probes need sh")
+	}
+
+	tests := []struct {
+		name     string
+		probe    []string
+		want     bool
+		want_err bool
+	}{
+		{name: "no probe", probe: nil, want: true},
+		{name: "passes", probe: []string{"sh", "-c", "exit 0"}, want: true},
+		{name: "fails", probe: []string{"sh", "-c", "exit 3"}, want: false},
+		{name: "runs in the repo", probe: []string{"sh", "-c", "test -f marker"}, want: true},
+		{name: "missing command", probe: []string{"ecsact-common-missing-probe"}, want_err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo_dir := t.TempDir()
+			writeTestFile(t, filepath.Join(repo_dir, "marker"), "", 0644)
+
+			got, err := runProbe(test.probe, repo_dir)
+			if test.want_err {
+				if err == nil {
+					t.Fatalf("runProbe(%q) = %v, want an error", test.probe, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runProbe(%q) failed: %v", test.probe, err)
+			}
+			if got != test.want {
+				t.Errorf("runProbe(%q) = %v, want %v", test.probe, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunProbeCancelled(t *testing.T) {
+	defer func(ctx context.Context) { runCtx = ctx }(runCtx)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runCtx = ctx
+
+	_, err := runProbe([]string{"sh", "-c", "exit 1"}, t.TempDir())
+	if err == nil {
+		t.Error("runProbe() succeeded after the run was cancelled")
+	}
+}
+
+func TestProbeCommand(t *testing.T) {
+	c := &Config{
+		Probe:      []string{"make", "check"},
+		RepoProbes: map[string][]string{"beta": {"./probe.sh"}},
+	}
+	if got := probeCommand(c, "alpha"); len(got) != 2 || got[0] != "make" {
+		t.Errorf("probeCommand(alpha) = %q, want the global probe", got)
+	}
+	if got := probeCommand(c, "beta"); len(got) != 1 || got[0] != "./probe.sh" {
+		t.Errorf("probeCommand(beta) = %q, want the repo probe", got)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Name of the branch sync PRs are opened from unless branch_name is set
+const defaultSyncBranchName = "chore/sync-with-ecsact-common"
+
+// syncBranch returns the branch sync PRs for repo_name are opened from, with
+// {repo} in branch_name replaced by the repo name.
+func (c *Config) syncBranch(repo_name string) string {
+	return strings.ReplaceAll(c.syncBranchTemplate(), "{repo}", repo_name)
+}
+
+// syncBranchTemplate is branch_name or the default sync branch.
+func (c *Config) syncBranchTemplate() string {
+	if c.BranchName == "" {
+		return defaultSyncBranchName
+	}
+	return c.BranchName
+}
+
+func listRemoteBranches(repo string) ([]string, error) {
+	output, err := runGh(
+		"api", "--paginate",
+		fmt.Sprintf("repos/%s/branches", orgRepo(repo)),
+		"--jq", ".[].name",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing branches of %s: %w", repo, err)
+	}
+
+	return strings.Fields(string(output)), nil
+}
+
+func hasOpenPr(repo string, branch string) (bool, error) {
+	output, err := runGh(
+		"pr", "list",
+		"-R", orgRepo(repo),
+		"--head", branch,
+		"--state", "open",
+		"--json=number",
+		"--jq", "length",
+	)
+	if err != nil {
+		return false, fmt.Errorf("listing PRs of %s for %s: %w", repo, branch, err)
+	}
+
+	return strings.TrimSpace(string(output)) != "0", nil
+}
+
+func deleteRemoteBranch(repo string, branch string) error {
+	_, err := runGh(
+		"api", "-X", "DELETE",
+		fmt.Sprintf("repos/%s/git/refs/heads/%s", orgRepo(repo), branch),
+	)
+	if err != nil {
+		return fmt.Errorf("deleting %s in %s: %w", branch, repo, err)
+	}
+	return nil
+}
+
+// pruneSyncBranches deletes sync_branch in repo if it no longer has an open
+// PR, e.g. because it was merged or closed. Only the exact branch is
+// considered, not human branches named after it.
+func pruneSyncBranches(repo string, sync_branch string) error {
+	branches, err := listRemoteBranches(repo)
+	if err != nil {
+		return err
+	}
+
+	for _, branch := range branches {
+		if branch != sync_branch {
+			continue
+		}
+
+		open, err := hasOpenPr(repo, branch)
+		if err != nil {
+			return err
+		}
+		if open {
+			continue
+		}
+
+		err = deleteRemoteBranch(repo, branch)
+		if err != nil {
+			return err
+		}
+		logInfo("pruned %s in %s", branch, repo)
+	}
+
+	return nil
+}
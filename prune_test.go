@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPruneSyncBranches(t *testing.T) {
+	sync_branch := defaultSyncBranchName
+	tests := []struct {
+		name        string
+		open_pr     bool
+		want_pruned bool
+	}{
+		{name: "merged PR", open_pr: false, want_pruned: true},
+		{name: "open PR", open_pr: true, want_pruned: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			open_count := "0"
+			if test.open_pr {
+				open_count = "1"
+			}
+			gh_log := fakeGh(t, `
+case "$1 $2" in
+  "api --paginate") printf '%s\n' main `+sync_branch+` `+sync_branch+`-experiment;;
+  "pr list") echo `+open_count+`;;
+esac
+`)
+
+			err := pruneSyncBranches("alpha", sync_branch)
+			if err != nil {
+				t.Fatalf("pruneSyncBranches() failed: %v", err)
+			}
+
+			calls := readGhLog(t, gh_log)
+			pruned := strings.Contains(calls, "DELETE repos/"+orgRepo("alpha")+"/git/refs/heads/"+sync_branch+"\n")
+			if pruned != test.want_pruned {
+				t.Errorf("pruneSyncBranches() pruned %s %v, want %v, gh calls:\n%s", sync_branch, pruned, test.want_pruned, calls)
+			}
+			if strings.Contains(calls, "-experiment") {
+				t.Errorf("pruneSyncBranches() touched a branch it didn't create, gh calls:\n%s", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// runGit runs git with args in dir and returns its stdout. A variable so the
+// git subprocess can be replaced.
+var runGit = func(dir string, args ...string) ([]byte, error) {
+	logCommand("git", args)
+	cmd := exec.CommandContext(runCtx, "git", args...)
+	cmd.Dir = dir
+	cmd.WaitDelay = cancelWaitDelay
+	if len(gitEnv) > 0 {
+		cmd.Env = append(os.Environ(), gitEnv...)
+	}
+
+	output, err := cmd.Output()
+	if exit_err, ok := err.(*exec.ExitError); ok {
+		return output, fmt.Errorf(
+			"git %s: %w: %s",
+			strings.Join(args, " "), err, strings.TrimSpace(string(exit_err.Stderr)),
+		)
+	}
+	return output, err
+}
+
+// remoteBranchTip returns the commit branch_name points to on origin.
+func remoteBranchTip(clone_dir string, branch_name string) (plumbing.Hash, error) {
+	output, err := runGit(clone_dir, "ls-remote", "origin", "refs/heads/"+branch_name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+
+	return plumbing.NewHash(fields[0]), nil
+}
+
+// Returned by commitAndPush when the worktree has no changes to commit
+var errNothingToCommit = errors.New("nothing to commit")
+
+// commitAndPush commits everything in worktree and pushes branch_name to
+// origin, force pushing when the branch is recreated rather than stacked on
+// the remote branch. The push is verified by checking that the remote branch
+// points at the new commit afterwards.
+func commitAndPush(
+	clone_dir string,
+	branch_name string,
+	worktree *git.Worktree,
+	commit_message string,
+	signature *object.Signature,
+	force bool,
+) error {
+	err := worktree.AddGlob(".")
+	if err != nil {
+		return err
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return err
+	}
+	if status.IsClean() {
+		return errNothingToCommit
+	}
+
+	var commit plumbing.Hash
+	if commitSigning != nil && commitSigning.entity == nil {
+		sha, err := commitSigning.gitCommit(clone_dir, commit_message, signature)
+		if err != nil {
+			return err
+		}
+		commit = plumbing.NewHash(sha)
+	} else {
+		options := &git.CommitOptions{Author: signature}
+		if commitSigning != nil {
+			options.SignKey = commitSigning.entity
+		}
+		commit, err = worktree.Commit(commit_message, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	push_args := []string{"push", "origin", "-u", branch_name}
+	if force {
+		push_args = append(push_args, "--force")
+	}
+	err = withRetries("push of "+branch_name, func() error {
+		_, err := runGit(clone_dir, push_args...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	tip, err := remoteBranchTip(clone_dir, branch_name)
+	if err != nil {
+		return fmt.Errorf("verifying push of %s: %w", branch_name, err)
+	}
+	if tip != commit {
+		return fmt.Errorf(
+			"push of %s did not update the remote branch: expected %s, remote is at %s",
+			branch_name, commit, tip,
+		)
+	}
+
+	return nil
+}
+
+// checkoutSyncBranch checks out branch_name in repo, stacked on the remote
+// branch when from_remote is set and it exists, otherwise created fresh from
+// HEAD. Reports whether the remote branch was used.
+func checkoutSyncBranch(
+	repo *git.Repository,
+	worktree *git.Worktree,
+	clone_dir string,
+	branch_name string,
+	from_remote bool,
+) (bool, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return false, err
+	}
+	start := head.Hash()
+
+	var tip plumbing.Hash
+	if from_remote {
+		tip, err = remoteBranchTip(clone_dir, branch_name)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if !tip.IsZero() {
+		if _, err := repo.CommitObject(tip); err != nil {
+			err = repo.FetchContext(runCtx, &git.FetchOptions{
+				RemoteName: "origin",
+				Auth:       gitAuth,
+				RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf(
+					"+refs/heads/%s:refs/remotes/origin/%s", branch_name, branch_name,
+				))},
+			})
+			if err != nil && err != git.NoErrAlreadyUpToDate {
+				return false, fmt.Errorf("fetching %s: %w", branch_name, err)
+			}
+		}
+		start = tip
+	}
+
+	err = worktree.Checkout(&git.CheckoutOptions{
+		Hash:   start,
+		Branch: plumbing.NewBranchReferenceName(branch_name),
+		Create: true,
+		Force:  true,
+		Keep:   false,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return !tip.IsZero(), nil
+}
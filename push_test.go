@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// TestCommitAndPush checks that a push is only reported as done when the
+// remote branch ends up at the new commit.
+func TestCommitAndPush(t *testing.T) {
+	other := strings.Repeat("1", 40)
+
+	tests := []struct {
+		name  string
+		force bool
+		// ls-remote output given the hash of the new commit
+		lsRemote func(commit string) string
+		pushErr  error
+		wantErr  string
+	}{
+		{
+			name:     "remote at the commit",
+			lsRemote: func(commit string) string { return commit + "\trefs/heads/sync\n" },
+		},
+		{
+			name:     "force",
+			force:    true,
+			lsRemote: func(commit string) string { return commit + "\trefs/heads/sync\n" },
+		},
+		{
+			name:     "remote at another commit",
+			lsRemote: func(string) string { return other + "\trefs/heads/sync\n" },
+			wantErr:  "remote is at " + other,
+		},
+		{
+			name:     "remote branch missing",
+			lsRemote: func(string) string { return "" },
+			wantErr:  "did not update the remote branch",
+		},
+		{
+			name:    "push fails",
+			pushErr: errors.New("rejected"),
+			wantErr: "rejected",
+		},
+	}
+
+	defer func(run func(string, ...string) ([]byte, error), count int) {
+		runGit = run
+		retryCount = count
+	}(runGit, retryCount)
+	retryCount = 0
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			repo, err := git.PlainInit(dir, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			worktree, err := repo.Worktree()
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, filepath.Join(dir, "README.md"), "# alpha\n", 0644)
+
+			var pushes [][]string
+			runGit = func(dir string, args ...string) ([]byte, error) {
+				switch args[0] {
+				case "push":
+					pushes = append(pushes, args)
+					return nil, test.pushErr
+				case "ls-remote":
+					head, err := repo.Head()
+					if err != nil {
+						t.Fatal(err)
+					}
+					return []byte(test.lsRemote(head.Hash().String())), nil
+				}
+				t.Fatalf("unexpected git %s", strings.Join(args, " "))
+				return nil, nil
+			}
+
+			signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+			err = commitAndPush(dir, "sync", worktree, "chore: sync", signature, test.force)
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("commitAndPush() failed: %v", err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("commitAndPush() = %v, want an error containing %q", err, test.wantErr)
+			}
+
+			if len(pushes) != 1 {
+				t.Fatalf("commitAndPush() pushed %d times, want once", len(pushes))
+			}
+			if got := slices.Contains(pushes[0], "--force"); got != test.force {
+				t.Errorf("git %s, want force %v", strings.Join(pushes[0], " "), test.force)
+			}
+		})
+	}
+}
+
+func TestCommitAndPushNothingToCommit(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(run func(string, ...string) ([]byte, error)) { runGit = run }(runGit)
+	runGit = func(dir string, args ...string) ([]byte, error) {
+		t.Fatalf("unexpected git %s", strings.Join(args, " "))
+		return nil, nil
+	}
+
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	err = commitAndPush(dir, "sync", worktree, "chore: sync", signature, false)
+	if err != errNothingToCommit {
+		t.Errorf("commitAndPush() of a clean worktree = %v, want errNothingToCommit", err)
+	}
+}
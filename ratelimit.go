@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Longest wait for a GitHub rate limit to reset before failing instead.
+var maxRateLimitWait = 15 * time.Minute
+
+// Wait after hitting a secondary rate limit that doesn't say when to retry,
+// as recommended by GitHub.
+const secondaryRateLimitWait = time.Minute
+
+func isRateLimitMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "rate limit")
+}
+
+// rateLimitWait returns how long to wait for the GitHub rate limit err ran
+// into to reset, ok is false when err isn't a rate limit.
+func rateLimitWait(err error) (wait time.Duration, ok bool) {
+	var api_err *githubApiError
+	if errors.As(err, &api_err) {
+		if api_err.StatusCode != http.StatusForbidden && api_err.StatusCode != http.StatusTooManyRequests {
+			return 0, false
+		}
+		switch {
+		case api_err.RetryAfter > 0:
+			return api_err.RetryAfter, true
+		case api_err.RateLimitRemaining == "0" && !api_err.RateLimitReset.IsZero():
+			return time.Until(api_err.RateLimitReset), true
+		case isRateLimitMessage(api_err.Message):
+			return secondaryRateLimitWait, true
+		}
+		return 0, false
+	}
+
+	if !isRateLimitMessage(err.Error()) {
+		return 0, false
+	}
+	reset, err := ghRateLimitReset()
+	if err != nil || reset.IsZero() {
+		return secondaryRateLimitWait, true
+	}
+	return time.Until(reset), true
+}
+
+// ghRateLimitReset asks gh when the exhausted REST or GraphQL rate limit
+// resets. Zero when neither is exhausted, i.e. a secondary rate limit was hit.
+func ghRateLimitReset() (time.Time, error) {
+	output, _, err := runGhOnce(nil, []string{"api", "rate_limit"})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	type rateLimit struct {
+		Remaining int   `json:"remaining"`
+		Reset     int64 `json:"reset"`
+	}
+	var limits struct {
+		Resources struct {
+			Core    rateLimit `json:"core"`
+			Graphql rateLimit `json:"graphql"`
+		} `json:"resources"`
+	}
+	err = json.Unmarshal(output, &limits)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var reset time.Time
+	for _, limit := range []rateLimit{limits.Resources.Core, limits.Resources.Graphql} {
+		limit_reset := time.Unix(limit.Reset, 0)
+		if limit.Remaining == 0 && limit_reset.After(reset) {
+			reset = limit_reset
+		}
+	}
+	return reset, nil
+}
+
+// parseRateLimitHeaders records the rate limit state of an API response in
+// api_err.
+func parseRateLimitHeaders(api_err *githubApiError, header http.Header) {
+	api_err.RateLimitRemaining = header.Get("X-RateLimit-Remaining")
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		api_err.RateLimitReset = time.Unix(reset, 0)
+	}
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+		api_err.RetryAfter = time.Duration(seconds) * time.Second
+	}
+}
+
+// retryWait returns the delay before retry attempt after err, waiting for
+// rate limits to reset instead of the usual backoff. Fails when the reset is
+// further away than maxRateLimitWait.
+func retryWait(attempt int, err error) (time.Duration, error) {
+	wait, ok := rateLimitWait(err)
+	if !ok {
+		return retryDelay(attempt), nil
+	}
+
+	wait = max(wait, time.Second)
+	if wait > maxRateLimitWait {
+		return 0, fmt.Errorf("rate limited for another %s: %w", wait.Round(time.Second), err)
+	}
+	logVerbose("Rate limited, waiting %s for the limit to reset", wait.Round(time.Second))
+	return wait, nil
+}
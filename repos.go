@@ -0,0 +1,51 @@
+package main
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfig is a single entry of repos in the config. Entries are either
+// just the repo name or a mapping of the name and per repo options:
+//
+//	repos:
+//	  - ecsact_runtime
+//	  - name: ecsact_parse
+//	    exclude: [.clang-format]
+type RepoConfig struct {
+	Name string `yaml:"name"`
+	// Globs of managed files not synced to the repo, matched against paths
+	// relative to FilesDir and destination paths
+	Exclude []string `yaml:"exclude"`
+	// Directory in the repo the managed files are synced into, e.g.
+	// packages/core in a monorepo. Defaults to the repo root.
+	DestPrefix string `yaml:"dest_prefix"`
+}
+
+func (r *RepoConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*r = RepoConfig{Name: value.Value}
+		return nil
+	}
+
+	type plain RepoConfig
+	return value.Decode((*plain)(r))
+}
+
+// repoConfig returns the config entry of repo_name. Repos only known from
+// the inventory have an entry with just their name.
+func (c *Config) repoConfig(repo_name string) RepoConfig {
+	for _, repo := range c.RepoConfigs {
+		if repo.Name == repo_name {
+			return repo
+		}
+	}
+	return RepoConfig{Name: repo_name}
+}
+
+// excludeGlobs returns the globs of managed files not synced to repo_name,
+// its own excludes, exclude_binary and the global exclude.
+func (c *Config) excludeGlobs(repo_name string) []string {
+	exclude := c.repoConfig(repo_name).Exclude
+	exclude = append(exclude[:len(exclude):len(exclude)], c.ExcludeBinary...)
+	return append(exclude, c.Exclude...)
+}
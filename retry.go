@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How many times transient clone, push, gh and API failures are retried and
+// the delay before the first retry, doubling with every further attempt. Set
+// in main() from gh_retries or -max-retries.
+var (
+	retryCount     = 2
+	retryBaseDelay = time.Second
+)
+
+// Lowercase substrings of error messages of failures worth retrying. Anything
+// else, e.g. an authentication failure, fails right away.
+var transientErrors = []string{
+	"timeout",
+	"timed out",
+	"connection reset",
+	"connection refused",
+	"tls handshake",
+	"unexpected eof",
+	"early eof",
+	"remote end hung up",
+	"could not resolve host",
+	"rate limit",
+	"http 429",
+	"http 500",
+	"http 502",
+	"http 503",
+	"http 504",
+}
+
+func isTransientMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, transient := range transientErrors {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTransientError reports whether err looks like a network hiccup, server
+// error or rate limit rather than a permanent failure.
+func isTransientError(err error) bool {
+	if runCtx.Err() != nil {
+		return false
+	}
+
+	var api_err *githubApiError
+	if errors.As(err, &api_err) {
+		switch {
+		case api_err.StatusCode == http.StatusTooManyRequests:
+			return true
+		case api_err.StatusCode >= 500:
+			return true
+		case api_err.StatusCode == http.StatusForbidden:
+			return isTransientMessage(api_err.Message)
+		}
+		return false
+	}
+
+	var net_err net.Error
+	if errors.As(err, &net_err) && net_err.Timeout() {
+		return true
+	}
+
+	return isTransientMessage(err.Error())
+}
+
+// retryDelay is the exponential backoff before retry attempt.
+func retryDelay(attempt int) time.Duration {
+	return retryBaseDelay << (attempt - 1)
+}
+
+// withRetries calls fn until it succeeds, fails with a non transient error or
+// has been retried retryCount times. what describes fn in retry messages.
+func withRetries(what string, fn func() error) error {
+	var err error
+	for attempt := 0; attempt <= retryCount; attempt++ {
+		if attempt > 0 {
+			delay, wait_err := retryWait(attempt, err)
+			if wait_err != nil {
+				return wait_err
+			}
+			logInfo("Retrying %s in %s: %s", what, delay, err)
+			if err := sleepCtx(delay); err != nil {
+				return err
+			}
+		}
+
+		err = fn()
+		if err == nil || !isTransientError(err) {
+			return err
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o deadline reached" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection reset", err: errors.New("read tcp: connection reset by peer"), want: true},
+		{name: "case insensitive", err: errors.New("Could Not Resolve Host: github.com"), want: true},
+		{name: "gh server error", err: errors.New("gh pr create: exit status 1: HTTP 502: Bad Gateway"), want: true},
+		{name: "wrapped", err: fmt.Errorf("clone: %w", errors.New("early EOF")), want: true},
+		{name: "auth failure", err: errors.New("authentication required"), want: false},
+		{name: "not found", err: errors.New("HTTP 404: Not Found"), want: false},
+		{name: "net timeout", err: fmt.Errorf("push: %w", timeoutError{}), want: true},
+		{name: "api too many requests", err: &githubApiError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "api server error", err: &githubApiError{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{
+			name: "api secondary rate limit",
+			err:  &githubApiError{StatusCode: http.StatusForbidden, Message: "You have exceeded a secondary rate limit"},
+			want: true,
+		},
+		{
+			name: "api forbidden",
+			err:  &githubApiError{StatusCode: http.StatusForbidden, Message: "Resource not accessible by integration"},
+			want: false,
+		},
+		{name: "api unprocessable", err: &githubApiError{StatusCode: http.StatusUnprocessableEntity, Message: "timeout"}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isTransientError(test.err); got != test.want {
+				t.Errorf("isTransientError(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsTransientErrorCancelled(t *testing.T) {
+	defer func(ctx context.Context) { runCtx = ctx }(runCtx)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runCtx = ctx
+
+	if isTransientError(errors.New("connection reset")) {
+		t.Error("isTransientError() = true after the run was cancelled")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Second
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 5, want: 16 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.attempt), func(t *testing.T) {
+			if got := retryDelay(test.attempt); got != test.want {
+				t.Errorf("retryDelay(%d) = %v, want %v", test.attempt, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Minimal subset of SARIF 2.1.0 needed to report out of sync files
+type sarifLog struct {
+	mu sync.Mutex
+
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool sarifTool `json:"tool"`
+	// Root of each repo with results by its name
+	OriginalUriBaseIds map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	Uri       string `json:"uri"`
+	UriBaseId string `json:"uriBaseId,omitempty"`
+}
+
+const (
+	sarifRuleFileDrift   = "ecsact-common/file-drift"
+	sarifRuleFileMissing = "ecsact-common/file-missing"
+	sarifRuleFileDeleted = "ecsact-common/file-deleted"
+)
+
+func newSarifLog() *sarifLog {
+	return &sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "ecsact_common",
+				InformationUri: "https://github.com/ecsact-dev/ecsact_common",
+				Rules: []sarifRule{
+					{
+						Id:               sarifRuleFileDrift,
+						ShortDescription: sarifMessage{"Managed file differs from ecsact_common"},
+					},
+					{
+						Id:               sarifRuleFileMissing,
+						ShortDescription: sarifMessage{"Managed file is missing"},
+					},
+					{
+						Id:               sarifRuleFileDeleted,
+						ShortDescription: sarifMessage{"Previously synced file is no longer managed"},
+					},
+				},
+			}},
+			OriginalUriBaseIds: map[string]sarifArtifactLocation{},
+			Results:            []sarifResult{},
+		}},
+	}
+}
+
+// addFilesDiff adds a result for every out of sync file in repo_name, located
+// at its path in repo_name relative to the uriBaseId named after the repo.
+func (l *sarifLog) addFilesDiff(repo_name string, files_diff *FilesDiff) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(diffPaths(files_diff)) == 0 {
+		return
+	}
+	l.Runs[0].OriginalUriBaseIds[repo_name] = sarifArtifactLocation{
+		Uri: "https://github.com/" + orgRepo(repo_name) + "/",
+	}
+	add := func(rule_id string, file_rel string, message string) {
+		l.Runs[0].Results = append(l.Runs[0].Results, sarifResult{
+			RuleId:  rule_id,
+			Level:   "warning",
+			Message: sarifMessage{message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{
+						Uri:       file_rel,
+						UriBaseId: repo_name,
+					},
+				},
+			}},
+			Properties: map[string]string{
+				"repo": repo_name,
+				"path": file_rel,
+			},
+		})
+	}
+
+	for _, file_rel := range files_diff.ChangedFiles {
+		add(sarifRuleFileDrift, file_rel, fmt.Sprintf("%s in %s is out of sync", file_rel, repo_name))
+	}
+	for _, file_rel := range files_diff.NewFiles {
+		add(sarifRuleFileMissing, file_rel, fmt.Sprintf("%s is missing from %s", file_rel, repo_name))
+	}
+	for _, file_rel := range files_diff.DeletedFiles {
+		add(sarifRuleFileDeleted, file_rel, fmt.Sprintf("%s is no longer managed and pending deletion from %s", file_rel, repo_name))
+	}
+}
+
+func (l *sarifLog) write(filename string) error {
+	content, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(content, '\n'), 0644)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSarifLog(t *testing.T) {
+	l := newSarifLog()
+	l.addFilesDiff("alpha", &FilesDiff{
+		NewFiles:     []string{".github/workflows/main.yml"},
+		ChangedFiles: []string{".editorconfig"},
+		DeletedFiles: []string{"old.txt"},
+		Mappings: map[string]fileMapping{
+			".github/workflows/main.yml": {Source: "/abs/files/.github/workflows/main.yml", Dest: ".github/workflows/main.yml"},
+			".editorconfig":              {Source: "/abs/files/.editorconfig", Dest: ".editorconfig"},
+		},
+	})
+	l.addFilesDiff("beta", &FilesDiff{
+		ChangedFiles: []string{".editorconfig"},
+		Mappings:     map[string]fileMapping{".editorconfig": {Source: "/abs/files/.editorconfig", Dest: ".editorconfig"}},
+	})
+	l.addFilesDiff("gamma", &FilesDiff{})
+
+	filename := filepath.Join(t.TempDir(), "out.sarif")
+	err := l.write(filename)
+	if err != nil {
+		t.Fatalf("write() failed: %v", err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var written struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			OriginalUriBaseIds map[string]struct {
+				Uri string `json:"uri"`
+			} `json:"originalUriBaseIds"`
+			Results []struct {
+				RuleId    string `json:"ruleId"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							Uri       string `json:"uri"`
+							UriBaseId string `json:"uriBaseId"`
+						} `json:"artifactLocation"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+				Properties map[string]string `json:"properties"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	err = json.Unmarshal(content, &written)
+	if err != nil {
+		t.Fatalf("write() wrote invalid JSON: %v", err)
+	}
+	if written.Version != "2.1.0" || len(written.Runs) != 1 {
+		t.Fatalf("write() wrote version %q with %d runs", written.Version, len(written.Runs))
+	}
+	run := written.Runs[0]
+
+	want := []struct {
+		rule string
+		repo string
+		uri  string
+	}{
+		{rule: sarifRuleFileDrift, repo: "alpha", uri: ".editorconfig"},
+		{rule: sarifRuleFileMissing, repo: "alpha", uri: ".github/workflows/main.yml"},
+		{rule: sarifRuleFileDeleted, repo: "alpha", uri: "old.txt"},
+		{rule: sarifRuleFileDrift, repo: "beta", uri: ".editorconfig"},
+	}
+	if len(run.Results) != len(want) {
+		t.Fatalf("write() wrote %d results, want %d", len(run.Results), len(want))
+	}
+	for i, want := range want {
+		result := run.Results[i]
+		location := result.Locations[0].PhysicalLocation.ArtifactLocation
+		if result.RuleId != want.rule || location.Uri != want.uri || location.UriBaseId != want.repo {
+			t.Errorf("result %d = %s at %s relative to %s, want %s at %s relative to %s",
+				i, result.RuleId, location.Uri, location.UriBaseId, want.rule, want.uri, want.repo)
+		}
+		if result.Properties["repo"] != want.repo {
+			t.Errorf("result %d repo = %q, want %q", i, result.Properties["repo"], want.repo)
+		}
+	}
+
+	if got := run.OriginalUriBaseIds["beta"].Uri; got != "https://github.com/"+orgRepo("beta")+"/" {
+		t.Errorf("beta base URI = %q", got)
+	}
+	if _, ok := run.OriginalUriBaseIds["gamma"]; ok {
+		t.Error("write() recorded a base URI for gamma, which has no results")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type SecretScanConfig struct {
+	// "warn" logs findings and continues, "block" fails the repo. Scanning is
+	// disabled when empty.
+	Mode string `yaml:"mode"`
+	// Globs of the destination paths of files that aren't scanned
+	AllowPaths []string `yaml:"allow_paths"`
+	// Regular expressions of finding texts that aren't reported, e.g. a
+	// known test fixture
+	AllowPatterns []string `yaml:"allow_patterns"`
+}
+
+var secretRules = []struct {
+	Id      string
+	Pattern *regexp.Regexp
+}{
+	{"github-token", regexp.MustCompile(`gh[opsur]_[A-Za-z0-9]{36}`)},
+	{"github-fine-grained-token", regexp.MustCompile(`github_pat_[A-Za-z0-9_]{22,}`)},
+	{"aws-access-key-id", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"slack-token", regexp.MustCompile(`xox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"private-key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY( BLOCK)?-----`)},
+	{"generic-secret", regexp.MustCompile(`(?i)(api[_-]?key|secret|password|token)\s*[:=]\s*['"][^'"\s]{16,}['"]`)},
+}
+
+type secretFinding struct {
+	File string
+	Line int
+	Rule string
+	Text string
+}
+
+func (f secretFinding) String() string {
+	return fmt.Sprintf("%s:%d: possible secret (%s)", f.File, f.Line, f.Rule)
+}
+
+type secretScanner struct {
+	// Whether findings fail the repo rather than only being logged
+	block          bool
+	allow_paths    []string
+	allow_patterns []*regexp.Regexp
+}
+
+func newSecretScanner(c SecretScanConfig) (*secretScanner, error) {
+	if c.Mode != "warn" && c.Mode != "block" {
+		return nil, fmt.Errorf("secret_scan mode must be warn or block, got %q", c.Mode)
+	}
+
+	scanner := &secretScanner{block: c.Mode == "block", allow_paths: c.AllowPaths}
+	for _, allow := range c.AllowPatterns {
+		pattern, err := regexp.Compile(allow)
+		if err != nil {
+			return nil, fmt.Errorf("secret_scan allow_patterns: %w", err)
+		}
+		scanner.allow_patterns = append(scanner.allow_patterns, pattern)
+	}
+
+	return scanner, nil
+}
+
+func (s *secretScanner) allowed(text string) bool {
+	for _, pattern := range s.allow_patterns {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan returns every non allowlisted finding in content of file_rel.
+func (s *secretScanner) scan(file_rel string, content []byte) []secretFinding {
+	if isBinary(content) || matchAnyGlob(s.allow_paths, file_rel) {
+		return nil
+	}
+
+	var findings []secretFinding
+	for i, line := range strings.Split(string(content), "\n") {
+		for _, rule := range secretRules {
+			for _, text := range rule.Pattern.FindAllString(line, -1) {
+				if s.allowed(text) {
+					continue
+				}
+				findings = append(findings, secretFinding{
+					File: file_rel,
+					Line: i + 1,
+					Rule: rule.Id,
+					Text: text,
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// scanFilesDiff scans the rendered content of every new and changed file.
+func (s *secretScanner) scanFilesDiff(files_diff *FilesDiff) ([]secretFinding, error) {
+	var findings []secretFinding
+	for _, files := range [][]string{files_diff.NewFiles, files_diff.ChangedFiles} {
+		for _, file_rel := range files {
+			content, err := files_diff.Mappings[file_rel].render()
+			if err != nil {
+				return nil, err
+			}
+			findings = append(findings, s.scan(file_rel, content)...)
+		}
+	}
+	return findings, nil
+}
+
+// check logs the findings in files_diff, failing when there are any in block
+// mode.
+func (s *secretScanner) check(files_diff *FilesDiff) error {
+	findings, err := s.scanFilesDiff(files_diff)
+	if err != nil {
+		return err
+	}
+
+	for _, finding := range findings {
+		logWarn("%s", finding)
+	}
+	if len(findings) > 0 && s.block {
+		return fmt.Errorf("not syncing, %d possible secrets found", len(findings))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// SigningConfig configures signing of the sync commits. Without a key commits
+// are unsigned.
+type SigningConfig struct {
+	// Armored OpenPGP private key file commits are signed with in process
+	KeyFile string `yaml:"key_file"`
+	// Environment variable holding the passphrase of KeyFile, defaults to
+	// GPG_PASSPHRASE
+	PassphraseEnv string `yaml:"passphrase_env"`
+	// GPG key ID or SSH key path commits are signed with by `git commit -S`
+	// instead, for keys held by gpg-agent or ssh-agent
+	Key string `yaml:"key"`
+	// Format of Key, openpgp (the default) or ssh
+	Format string `yaml:"format"`
+}
+
+// commitSigner signs sync commits with either an in process OpenPGP key or
+// the git CLI.
+type commitSigner struct {
+	entity *openpgp.Entity
+	key    string
+	format string
+}
+
+// Signer of the sync commits, nil to leave them unsigned. Set in main().
+var commitSigning *commitSigner
+
+// newCommitSigner loads the configured signing key, failing when it's
+// missing or can't be unlocked. Returns nil without a configured key.
+func newCommitSigner(c SigningConfig) (*commitSigner, error) {
+	if c.KeyFile != "" && c.Key != "" {
+		return nil, errors.New("signing: set only one of key_file and key")
+	}
+
+	if c.Key != "" {
+		format := c.Format
+		if format == "" {
+			format = "openpgp"
+		}
+		if format != "openpgp" && format != "ssh" {
+			return nil, fmt.Errorf("signing: format must be openpgp or ssh, got %q", format)
+		}
+		return &commitSigner{key: c.Key, format: format}, nil
+	}
+
+	if c.KeyFile == "" {
+		return nil, nil
+	}
+
+	entity, err := readSigningKey(c.KeyFile, c.PassphraseEnv)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", c.KeyFile, err)
+	}
+	return &commitSigner{entity: entity}, nil
+}
+
+func readSigningKey(key_file string, passphrase_env string) (*openpgp.Entity, error) {
+	f, err := os.Open(key_file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entities, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var entity *openpgp.Entity
+	for _, e := range entities {
+		if e.PrivateKey != nil {
+			entity = e
+			break
+		}
+	}
+	if entity == nil {
+		return nil, errors.New("no private key found")
+	}
+
+	if entity.PrivateKey.Encrypted {
+		if passphrase_env == "" {
+			passphrase_env = "GPG_PASSPHRASE"
+		}
+		passphrase := os.Getenv(passphrase_env)
+		if passphrase == "" {
+			return nil, fmt.Errorf("key is locked, set %s to its passphrase", passphrase_env)
+		}
+
+		err = entity.DecryptPrivateKeys([]byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("unlocking key with %s: %w", passphrase_env, err)
+		}
+	}
+
+	return entity, nil
+}
+
+// gitCommit commits the staged changes in clone_dir with the git CLI so the
+// commit is signed with the key of s, returning the new commit.
+func (s *commitSigner) gitCommit(clone_dir string, commit_message string, signature *object.Signature) (string, error) {
+	_, err := runGit(
+		clone_dir,
+		"-c", "user.name="+signature.Name,
+		"-c", "user.email="+signature.Email,
+		"-c", "gpg.format="+s.format,
+		"-c", "user.signingkey="+s.key,
+		"commit", "--no-verify",
+		"-S",
+		"--date", signature.When.Format("2006-01-02T15:04:05-07:00"),
+		"-m", commit_message,
+	)
+	if err != nil {
+		return "", fmt.Errorf("signing commit with %s, is the key available and unlocked? %w", s.key, err)
+	}
+
+	output, err := runGit(clone_dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var repoNameRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// readSkipFile reads a newline delimited list of repo names. Blank lines and
+// anything after a # are ignored.
+func readSkipFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var repos []string
+	scanner := bufio.NewScanner(f)
+	for line_num := 1; scanner.Scan(); line_num++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if !repoNameRegexp.MatchString(line) {
+			return nil, fmt.Errorf("%s:%d: invalid repo name %q", filename, line_num, line)
+		}
+
+		repos = append(repos, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("in file %q: %w", filename, err)
+	}
+
+	return repos, nil
+}
+
+// skipRepos removes skip, read from skip_file, from repos, logging every repo
+// removed and warning about names in skip that aren't in repos.
+func skipRepos(repos []string, skip []string, skip_file string) []string {
+	skip_set := map[string]bool{}
+	for _, repo := range skip {
+		skip_set[repo] = true
+	}
+
+	var result []string
+	for _, repo := range repos {
+		if skip_set[repo] {
+			logInfo("Skipping %s (listed in %s)", repo, skip_file)
+			delete(skip_set, repo)
+			continue
+		}
+		result = append(result, repo)
+	}
+
+	for _, repo := range skip {
+		if skip_set[repo] {
+			logWarn("%s lists %s, which is not a configured repo", skip_file, repo)
+		}
+	}
+
+	return result
+}
+
+// matchRepos returns the repos whose name matches pattern.
+func matchRepos(repos []string, pattern *regexp.Regexp) []string {
+	var result []string
+	for _, repo := range repos {
+		if pattern.MatchString(repo) {
+			result = append(result, repo)
+		}
+	}
+	return result
+}
+
+// selectRepos returns the repos of list, a comma separated list of names, in
+// the order of repos. Fails if list names a repo that isn't in repos.
+func selectRepos(repos []string, list string) ([]string, error) {
+	selected := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(repos, name) {
+			return nil, fmt.Errorf("%q is not a configured repo", name)
+		}
+		selected[name] = true
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("no repos given")
+	}
+
+	var result []string
+	for _, repo := range repos {
+		if selected[repo] {
+			result = append(result, repo)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadSkipFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		want     []string
+		want_err string
+	}{
+		{name: "empty", content: "", want: nil},
+		{name: "names", content: "ecsact_cli\necsact_runtime\n", want: []string{"ecsact_cli", "ecsact_runtime"}},
+		{
+			name:    "comments and blanks",
+			content: "# paused\n\n  ecsact_cli  # until the release\n\t\necsact.docs\n",
+			want:    []string{"ecsact_cli", "ecsact.docs"},
+		},
+		{name: "no trailing newline", content: "ecsact_cli", want: []string{"ecsact_cli"}},
+		{name: "windows line endings", content: "ecsact_cli\r\necsact_lsp\r\n", want: []string{"ecsact_cli", "ecsact_lsp"}},
+		{name: "invalid name", content: "ecsact_cli\necsact-dev/ecsact_lsp\n", want_err: `:2: invalid repo name "ecsact-dev/ecsact_lsp"`},
+		{name: "several names on a line", content: "ecsact_cli ecsact_lsp\n", want_err: ":1: invalid repo name"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "skip.txt")
+			writeTestFile(t, filename, test.content, 0644)
+
+			got, err := readSkipFile(filename)
+			if test.want_err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.want_err) {
+					t.Fatalf("readSkipFile() = %v, want an error containing %q", err, test.want_err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readSkipFile() failed: %v", err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("readSkipFile() = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	_, err := readSkipFile(filepath.Join(t.TempDir(), "missing.txt"))
+	if !os.IsNotExist(err) {
+		t.Errorf("readSkipFile() of a missing file = %v, want a not exist error", err)
+	}
+}
+
+func TestSkipRepos(t *testing.T) {
+	var got []string
+	output := captureStdout(t, func() {
+		got = skipRepos([]string{"alpha", "beta", "gamma"}, []string{"beta", "delta"}, "skip.txt")
+	})
+
+	if want := []string{"alpha", "gamma"}; !slices.Equal(got, want) {
+		t.Errorf("skipRepos() = %v, want %v", got, want)
+	}
+	if !strings.Contains(output, "Skipping beta (listed in skip.txt)") {
+		t.Errorf("skipRepos() logged %q, want beta reported as skipped", output)
+	}
+	if !strings.Contains(output, "WARNING: skip.txt lists delta, which is not a configured repo") {
+		t.Errorf("skipRepos() logged %q, want a warning about delta", output)
+	}
+}
+
+// captureStdout returns what f printed to os.Stdout, which logs go to.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		content, _ := io.ReadAll(r)
+		output <- string(content)
+	}()
+	f()
+	w.Close()
+	return <-output
+}
+
+func TestMatchRepos(t *testing.T) {
+	repos := []string{"ecsact_cli", "ecsact_runtime", "ecsact_rt_entt", "ecsact_parse", "ecsact-vscode"}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "runtime", want: []string{"ecsact_runtime"}},
+		{pattern: "^ecsact_r", want: []string{"ecsact_runtime", "ecsact_rt_entt"}},
+		{pattern: "ecsact_(cli|parse)$", want: []string{"ecsact_cli", "ecsact_parse"}},
+		{pattern: "-", want: []string{"ecsact-vscode"}},
+		{pattern: "(?i)CLI", want: []string{"ecsact_cli"}},
+		{pattern: "", want: repos},
+		{pattern: "^rt", want: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			got := matchRepos(repos, regexp.MustCompile(test.pattern))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("matchRepos(%q) = %v, want %v", test.pattern, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path"
+)
+
+// Directory in each repo holding the content of every managed file as it was
+// last synced
+const snapshotDir = ".ecsact-common/snapshots"
+
+// Results of mergeSnapshot
+const (
+	// The repo file is unchanged since the last sync, the update is clean
+	snapshotClean = "clean"
+	// Only the repo file changed since the last sync
+	snapshotDownstream = "downstream"
+	// Both the managed file and the repo file changed since the last sync
+	snapshotConflict = "conflict"
+)
+
+// mergeSnapshot compares the managed content, the repo content and the last
+// synced base content of a file.
+func mergeSnapshot(source, downstream, base []byte) string {
+	downstream_changed := !bytes.Equal(downstream, base)
+	source_changed := !bytes.Equal(source, base)
+
+	switch {
+	case !downstream_changed:
+		return snapshotClean
+	case !source_changed:
+		return snapshotDownstream
+	case bytes.Equal(source, downstream):
+		// Both sides converged on the same content
+		return snapshotClean
+	}
+	return snapshotConflict
+}
+
+// filterSnapshotConflicts removes changed files from files_diff that were
+// changed in the repo since the last sync while the managed file changed too,
+// so the repo changes aren't silently overwritten.
+func filterSnapshotConflicts(repo_name, repo_dir string, files_diff *FilesDiff, trace *fileTrace) error {
+	keep := func(file_rel string) (bool, error) {
+		base, err := os.ReadFile(path.Join(repo_dir, snapshotDir, file_rel))
+		if os.IsNotExist(err) {
+			trace.add(file_rel, "no snapshot of the last sync")
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		source, err := files_diff.Mappings[file_rel].render()
+		if err != nil {
+			return false, err
+		}
+		downstream, err := os.ReadFile(path.Join(repo_dir, file_rel))
+		if err != nil {
+			return false, err
+		}
+
+		switch mergeSnapshot(source, downstream, base) {
+		case snapshotDownstream:
+			trace.add(file_rel, "changed in repo since the last sync, managed file unchanged")
+			logWarn("%s changed %s since the last sync, restoring it", repo_name, file_rel)
+		case snapshotConflict:
+			trace.add(file_rel, "changed in both the repo and the managed files since the last sync")
+			trace.decide(file_rel, "skip (conflict)")
+			logWarn("conflict, %s changed %s since the last sync, not overwriting it", repo_name, file_rel)
+			return false, nil
+		}
+		return true, nil
+	}
+
+	var err error
+	files_diff.ChangedFiles, err = filterFiles(files_diff.ChangedFiles, keep)
+	return err
+}
+
+// writeSnapshots records the content of the new and changed files in
+// files_diff as the base of the next sync.
+func writeSnapshots(repo_dir string, files_diff *FilesDiff) error {
+	snapshot_dir := path.Join(repo_dir, snapshotDir)
+
+	err := copyFiles(files_diff, snapshot_dir, files_diff.NewFiles)
+	if err != nil {
+		return err
+	}
+	return copyFiles(files_diff, snapshot_dir, files_diff.ChangedFiles)
+}
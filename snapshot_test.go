@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestMergeSnapshot(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		downstream string
+		base       string
+		want       string
+	}{
+		{name: "unchanged", source: "a", downstream: "a", base: "a", want: snapshotClean},
+		{name: "managed file changed", source: "b", downstream: "a", base: "a", want: snapshotClean},
+		{name: "repo changed", source: "a", downstream: "b", base: "a", want: snapshotDownstream},
+		{name: "both changed", source: "b", downstream: "c", base: "a", want: snapshotConflict},
+		{name: "both converged", source: "b", downstream: "b", base: "a", want: snapshotClean},
+		{name: "repo emptied", source: "a", downstream: "", base: "a", want: snapshotDownstream},
+		{name: "empty base", source: "b", downstream: "c", base: "", want: snapshotConflict},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := mergeSnapshot([]byte(test.source), []byte(test.downstream), []byte(test.base))
+			if got != test.want {
+				t.Errorf("mergeSnapshot(%q, %q, %q) = %q, want %q", test.source, test.downstream, test.base, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Normalizers applied when soft_change_normalizers isn't configured
+var defaultSoftChangeNormalizers = []string{"eol", "trailing-whitespace"}
+
+var (
+	trailingWhitespaceRegexp = regexp.MustCompile(`(?m)[ \t]+$`)
+	blankLinesRegexp         = regexp.MustCompile(`\n{2,}`)
+	whitespaceRegexp         = regexp.MustCompile(`\s+`)
+)
+
+// softChangeNormalizer rewrites content so formatting only differences
+// compare equal.
+type softChangeNormalizer func(content []byte) []byte
+
+var softChangeNormalizers = map[string]softChangeNormalizer{
+	"eol": func(content []byte) []byte {
+		return convertEol(content, "lf")
+	},
+	"trailing-whitespace": func(content []byte) []byte {
+		return bytes.TrimRight(trailingWhitespaceRegexp.ReplaceAll(content, nil), "\n")
+	},
+	"blank-lines": func(content []byte) []byte {
+		return bytes.Trim(blankLinesRegexp.ReplaceAll(content, []byte("\n")), "\n")
+	},
+	"whitespace": func(content []byte) []byte {
+		return bytes.TrimSpace(whitespaceRegexp.ReplaceAll(content, []byte(" ")))
+	},
+}
+
+func parseSoftChangeNormalizers(names []string) ([]softChangeNormalizer, error) {
+	if len(names) == 0 {
+		names = defaultSoftChangeNormalizers
+	}
+
+	var normalizers []softChangeNormalizer
+	for _, name := range names {
+		normalizer, ok := softChangeNormalizers[name]
+		if !ok {
+			return nil, fmt.Errorf(
+				"soft_change_normalizers: unknown normalizer %q, expected eol, trailing-whitespace, blank-lines or whitespace",
+				name,
+			)
+		}
+		normalizers = append(normalizers, normalizer)
+	}
+	return normalizers, nil
+}
+
+// isSoftChange reports whether a and b are equal once normalized, i.e. they
+// only differ in formatting.
+func isSoftChange(normalizers []softChangeNormalizer, a, b []byte) bool {
+	if isBinary(a) || isBinary(b) {
+		return false
+	}
+	for _, normalize := range normalizers {
+		a = normalize(a)
+		b = normalize(b)
+	}
+	return bytes.Equal(a, b)
+}
+
+// classifyChanges returns "soft" or "hard" for each changed file in
+// files_diff.
+func classifyChanges(
+	normalizers []softChangeNormalizer,
+	repo_dir string,
+	files_diff *FilesDiff,
+) (map[string]string, error) {
+	classes := map[string]string{}
+	for _, file_rel := range files_diff.ChangedFiles {
+		content, err := files_diff.Mappings[file_rel].render()
+		if err != nil {
+			return nil, err
+		}
+		repo_content, err := os.ReadFile(repo_dir + "/" + file_rel)
+		if err != nil {
+			return nil, err
+		}
+
+		if isSoftChange(normalizers, content, repo_content) {
+			classes[file_rel] = "soft"
+		} else {
+			classes[file_rel] = "hard"
+		}
+	}
+	return classes, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIsSoftChange(t *testing.T) {
+	tests := []struct {
+		name        string
+		normalizers []string
+		a           string
+		b           string
+		want        bool
+	}{
+		{name: "eol", a: "a\nb\n", b: "a\r\nb\r\n", want: true},
+		{name: "trailing whitespace", a: "a  \nb\t\n", b: "a\nb\n", want: true},
+		{name: "trailing newlines", a: "a\n", b: "a\n\n\n", want: true},
+		{name: "content", a: "a\nb\n", b: "a\nc\n", want: false},
+		{name: "blank lines by default", a: "a\n\nb\n", b: "a\nb\n", want: false},
+		{name: "blank lines", normalizers: []string{"blank-lines"}, a: "a\n\n\nb\n", b: "a\nb", want: true},
+		{name: "indentation by default", a: "  a\n", b: "a\n", want: false},
+		{name: "whitespace", normalizers: []string{"whitespace"}, a: "  a   b\n", b: "a b", want: true},
+		{name: "only eol", normalizers: []string{"eol"}, a: "a \r\n", b: "a\n", want: false},
+		{name: "binary", a: "\x00a\n", b: "\x00a\r\n", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			normalizers, err := parseSoftChangeNormalizers(test.normalizers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := isSoftChange(normalizers, []byte(test.a), []byte(test.b)); got != test.want {
+				t.Errorf("isSoftChange(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+			}
+		})
+	}
+
+	if _, err := parseSoftChangeNormalizers([]string{"eol", "tabs"}); err == nil {
+		t.Error("parseSoftChangeNormalizers() with an unknown normalizer succeeded")
+	}
+}
+
+func TestClassifyChanges(t *testing.T) {
+	dir := t.TempDir()
+	repo_dir := filepath.Join(dir, "repo")
+	files_diff := &FilesDiff{Mappings: map[string]fileMapping{}}
+	for file_rel, contents := range map[string][2]string{
+		"README.md":       {"# common\n", "# common  \r\n"},
+		"scripts/lint.sh": {"#!/bin/sh\nlint\n", "#!/bin/sh\n"},
+	} {
+		source := filepath.Join(dir, "files", file_rel)
+		writeTestFile(t, source, contents[0], 0644)
+		writeTestFile(t, filepath.Join(repo_dir, file_rel), contents[1], 0644)
+		files_diff.ChangedFiles = append(files_diff.ChangedFiles, file_rel)
+		files_diff.Mappings[file_rel] = fileMapping{Source: source, Dest: file_rel}
+	}
+
+	normalizers, err := parseSoftChangeNormalizers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	classes, err := classifyChanges(normalizers, repo_dir, files_diff)
+	if err != nil {
+		t.Fatalf("classifyChanges() failed: %v", err)
+	}
+	if classes["README.md"] != "soft" || classes["scripts/lint.sh"] != "hard" || len(classes) != 2 {
+		t.Errorf("classifyChanges() = %v, want README.md soft and scripts/lint.sh hard", classes)
+	}
+
+	files_diff.ChangedFiles = append(files_diff.ChangedFiles, "missing.txt")
+	files_diff.Mappings["missing.txt"] = fileMapping{Source: filepath.Join(dir, "files", "README.md"), Dest: "missing.txt"}
+	if _, err := classifyChanges(normalizers, repo_dir, files_diff); err == nil {
+		t.Error("classifyChanges() of a file missing from the repo succeeded")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// runSourceCommand runs the configured source_command in FilesDir. Its stdout
+// is a newline delimited list of paths relative to FilesDir making up the
+// managed files.
+func runSourceCommand(c *Config) ([]string, error) {
+	cmd := exec.CommandContext(runCtx, c.SourceCommand[0], c.SourceCommand[1:]...)
+	cmd.Dir = c.FilesDir
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("source_command %s: %w", strings.Join(c.SourceCommand, " "), err)
+	}
+
+	return parseSourceFileList(c.FilesDir, output)
+}
+
+func parseSourceFileList(files_dir string, output []byte) ([]string, error) {
+	var files []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		file_rel := strings.TrimSpace(scanner.Text())
+		if file_rel == "" {
+			continue
+		}
+
+		file_rel = path.Clean(strings.ReplaceAll(file_rel, "\\", "/"))
+		if path.IsAbs(file_rel) || file_rel == ".." || strings.HasPrefix(file_rel, "../") {
+			return nil, fmt.Errorf("source_command: %q is not inside %s", file_rel, files_dir)
+		}
+		if file_rel == syncIgnoreFile {
+			continue
+		}
+
+		file := filepath.Join(files_dir, filepath.FromSlash(file_rel))
+		stat, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("source_command: %w", err)
+		}
+		if stat.IsDir() {
+			return nil, fmt.Errorf("source_command: %q is a directory", file_rel)
+		}
+
+		files = append(files, file)
+	}
+
+	return files, scanner.Err()
+}
+
+// managedFiles returns every managed file, walking FilesDir and/or running the
+// source command depending on config, filtered by include and exclude.
+func managedFiles(c *Config, trace *fileTrace) ([]string, error) {
+	if len(c.SourceCommand) == 0 {
+		files, err := getAllFiles(c.FilesDir, trace)
+		if err != nil {
+			return nil, err
+		}
+		return includedFiles(c, files, trace), nil
+	}
+
+	files, err := runSourceCommand(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.SourceCommandAugment {
+		walked, err := getAllFiles(c.FilesDir, trace)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range walked {
+			if !slices.Contains(files, file) {
+				files = append(files, file)
+			}
+		}
+	}
+
+	slices.Sort(files)
+	return includedFiles(c, files, trace), nil
+}
+
+// includedFiles returns the files matching the include globs, or all of them
+// without any, that don't match the exclude globs.
+func includedFiles(c *Config, files []string, trace *fileTrace) []string {
+	if len(c.Include) == 0 && len(c.Exclude) == 0 {
+		return files
+	}
+
+	var result []string
+	for _, file := range files {
+		file_rel := managedRelPath(c.FilesDir, file)
+		if len(c.Include) > 0 && !matchAnyGlob(c.Include, file_rel) {
+			trace.add(file_rel, "matches no include glob (%s)", strings.Join(c.Include, ", "))
+			trace.decide(file_rel, "skip (not included)")
+			continue
+		}
+		if pattern, ok := firstMatchingGlob(c.Exclude, file_rel); ok {
+			trace.add(file_rel, "matches exclude glob %q", pattern)
+			trace.decide(file_rel, "skip (excluded)")
+			continue
+		}
+		result = append(result, file)
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseSourceFileList(t *testing.T) {
+	files_dir := t.TempDir()
+	writeTestFile(t, filepath.Join(files_dir, "a.txt"), "a", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "sub", "b.txt"), "b", 0644)
+	writeTestFile(t, filepath.Join(files_dir, syncIgnoreFile), "*.bak", 0644)
+
+	tests := []struct {
+		name     string
+		output   string
+		want     []string
+		want_err bool
+	}{
+		{name: "empty", output: ""},
+		{
+			name:   "files",
+			output: "a.txt\n\n  sub/b.txt  \n",
+			want:   []string{"a.txt", "sub/b.txt"},
+		},
+		{name: "backslashes", output: "sub\\b.txt\r\n", want: []string{"sub/b.txt"}},
+		{name: "dot segments", output: "./sub/../a.txt\n", want: []string{"a.txt"}},
+		{name: "ignore file", output: syncIgnoreFile + "\na.txt\n", want: []string{"a.txt"}},
+		{name: "parent", output: "../a.txt\n", want_err: true},
+		{name: "parent itself", output: "..\n", want_err: true},
+		{name: "escapes", output: "sub/../../a.txt\n", want_err: true},
+		{name: "backslash escapes", output: "sub\\..\\..\\a.txt\n", want_err: true},
+		{name: "absolute", output: "/etc/passwd\n", want_err: true},
+		{name: "missing", output: "missing.txt\n", want_err: true},
+		{name: "directory", output: "sub\n", want_err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseSourceFileList(files_dir, []byte(test.output))
+			if test.want_err {
+				if err == nil {
+					t.Fatalf("parseSourceFileList(%q) = %v, want an error", test.output, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSourceFileList(%q) failed: %v", test.output, err)
+			}
+
+			var want []string
+			for _, file_rel := range test.want {
+				want = append(want, filepath.Join(files_dir, filepath.FromSlash(file_rel)))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("parseSourceFileList(%q) = %v, want %v", test.output, got, want)
+			}
+		})
+	}
+}
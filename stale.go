@@ -0,0 +1,57 @@
+package main
+
+import "fmt"
+
+// StaleConfig configures -close-stale, which closes the open sync PR of a repo
+// that is back in sync, e.g. after a template change was reverted.
+type StaleConfig struct {
+	// Comment left on the stale PR before closing it
+	Comment string `yaml:"comment"`
+	// Also delete the sync branch of the closed PR
+	DeleteBranch bool `yaml:"delete_branch"`
+}
+
+// closeStalePr closes the open sync PR of repo_name, which has no changes to
+// sync, if there is one and -close-stale is set.
+func (s *repoSync) closeStalePr(repo_name string, result *repoResult) error {
+	c := s.c
+	if !*closeStale || *checkDrift {
+		return nil
+	}
+
+	pr_num, err := prClient.FindPr(repo_name, c.syncBranch(repo_name), c.PrTitle, c.AuthorLogin)
+	if err != nil {
+		return fmt.Errorf("PR step failed: %w", err)
+	}
+	if pr_num == nil {
+		return nil
+	}
+
+	if *dryRun {
+		logInfo("Would close stale %s#%d", repo_name, *pr_num)
+		return nil
+	}
+
+	comment := c.Stale.Comment
+	if comment == "" {
+		comment = fmt.Sprintf(
+			"Closing, %s is in sync with %s again so this PR is no longer needed.",
+			repo_name, orgRepo("ecsact_common"),
+		)
+	}
+
+	err = closePr(repo_name, *pr_num, comment)
+	if err != nil {
+		return fmt.Errorf("closing stale %s#%d: %w", repo_name, *pr_num, err)
+	}
+	logInfo("closed stale %s#%d", repo_name, *pr_num)
+
+	result.PrNumber = *pr_num
+	result.PrUrl = prWebUrl(repo_name, *pr_num)
+	result.Action = "closed"
+
+	if c.Stale.DeleteBranch {
+		return deleteRemoteBranch(repo_name, c.syncBranch(repo_name))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// printSummary lists which repos synced successfully along with the URL of
+// their sync PR in pr_urls, why the others failed or were skipped and which
+// were cancelled, in the order of repos.
+func printSummary(
+	repos []string,
+	succeeded []string,
+	failures map[string]error,
+	cancelled []string,
+	pr_urls map[string]string,
+	skipped map[string]string,
+) {
+	var lines []string
+	ok_count := 0
+	for _, repo_name := range repos {
+		if err, failed := failures[repo_name]; failed {
+			lines = append(lines, fmt.Sprintf("  FAILED %s: %s", repo_name, err))
+		} else if reason, ok := skipped[repo_name]; ok {
+			lines = append(lines, fmt.Sprintf("  skipped %s: %s", repo_name, reason))
+		} else if slices.Contains(succeeded, repo_name) {
+			line := fmt.Sprintf("  ok     %s", repo_name)
+			if pr_url := pr_urls[repo_name]; pr_url != "" {
+				line += " " + pr_url
+			}
+			lines = append(lines, line)
+			ok_count++
+		} else if slices.Contains(cancelled, repo_name) {
+			lines = append(lines, fmt.Sprintf("  CANCELLED %s", repo_name))
+		}
+	}
+
+	counts := fmt.Sprintf("Synced %d repos, %d failed", ok_count, len(failures))
+	if len(skipped) > 0 {
+		counts += fmt.Sprintf(", %d skipped", len(skipped))
+	}
+	if len(cancelled) > 0 {
+		counts += fmt.Sprintf(", %d cancelled", len(cancelled))
+	}
+	fmt.Println(counts)
+	if len(lines) > 0 {
+		fmt.Println(strings.Join(lines, "\n"))
+	}
+}
+
+// syncSize returns the total size of the new and changed files of files_diff
+// as they are written to the repo.
+func syncSize(files_diff *FilesDiff) (int64, error) {
+	var size int64
+	for _, file_rel := range append(slices.Clone(files_diff.NewFiles), files_diff.ChangedFiles...) {
+		mapping := files_diff.Mappings[file_rel]
+		if mapping.transformed() {
+			content, err := mapping.render()
+			if err != nil {
+				return 0, err
+			}
+			size += int64(len(content))
+			continue
+		}
+
+		stat, err := os.Stat(mapping.Source)
+		if err != nil {
+			return 0, err
+		}
+		size += stat.Size()
+	}
+	return size, nil
+}
+
+// logSyncSummary logs how many files files_diff adds, changes and deletes in
+// repo_name and their total size, which is returned.
+func logSyncSummary(repo_name string, files_diff *FilesDiff) (int64, error) {
+	size, err := syncSize(files_diff)
+	if err != nil {
+		return 0, err
+	}
+
+	logInfo("%s: %s", repo_name, changeCounts(
+		len(files_diff.NewFiles), len(files_diff.ChangedFiles), len(files_diff.DeletedFiles), size,
+	))
+	return size, nil
+}
+
+// changeCounts formats file counts and their size, e.g.
+// "2 new, 3 changed (14.2 KB)". Deletions are only mentioned when there are
+// any.
+func changeCounts(new_count int, changed_count int, deleted_count int, size int64) string {
+	counts := fmt.Sprintf("%d new, %d changed", new_count, changed_count)
+	if deleted_count > 0 {
+		counts += fmt.Sprintf(", %d deleted", deleted_count)
+	}
+	return fmt.Sprintf("%s (%s)", counts, formatBytes(size))
+}
+
+func formatBytes(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size)
+	unit := ""
+	for _, next := range []string{"KB", "MB", "GB"} {
+		value /= 1024
+		unit = next
+		if value < 1024 {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f %s", value, unit)
+}
+
+// printTotals prints the files and bytes synced across all repos of results.
+func printTotals(results []*repoResult) {
+	var new_count, changed_count, deleted_count, repo_count int
+	var size int64
+	for _, result := range results {
+		if result.err != nil || len(result.NewFiles)+len(result.ChangedFiles)+len(result.DeletedFiles) == 0 {
+			continue
+		}
+		new_count += len(result.NewFiles)
+		changed_count += len(result.ChangedFiles)
+		deleted_count += len(result.DeletedFiles)
+		size += result.Bytes
+		repo_count++
+	}
+
+	fmt.Printf("Total: %s in %d repos\n", changeCounts(new_count, changed_count, deleted_count, size), repo_count)
+}
+
+// writeJsonResults writes results as a JSON array to w in the order of repos.
+func writeJsonResults(w io.Writer, repos []string, results []*repoResult) error {
+	sorted := slices.Clone(results)
+	slices.SortStableFunc(sorted, func(a, b *repoResult) int {
+		return slices.Index(repos, a.Repo) - slices.Index(repos, b.Repo)
+	})
+	if sorted == nil {
+		sorted = []*repoResult{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sorted)
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 0, want: "0 B"},
+		{size: 1023, want: "1023 B"},
+		{size: 1024, want: "1.0 KB"},
+		{size: 1536, want: "1.5 KB"},
+		{size: 1024*1024 - 1, want: "1024.0 KB"},
+		{size: 1024 * 1024, want: "1.0 MB"},
+		{size: 5 * 1024 * 1024 * 1024, want: "5.0 GB"},
+		{size: 3 * 1024 * 1024 * 1024 * 1024, want: "3072.0 GB"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if got := formatBytes(test.size); got != test.want {
+				t.Errorf("formatBytes(%d) = %q, want %q", test.size, got, test.want)
+			}
+		})
+	}
+}
+
+func TestChangeCounts(t *testing.T) {
+	tests := []struct {
+		name                                    string
+		new_count, changed_count, deleted_count int
+		size                                    int64
+		want                                    string
+	}{
+		{name: "nothing", want: "0 new, 0 changed (0 B)"},
+		{name: "no deletions", new_count: 2, changed_count: 3, size: 2048, want: "2 new, 3 changed (2.0 KB)"},
+		{name: "deletions", new_count: 1, changed_count: 0, deleted_count: 4, size: 10, want: "1 new, 0 changed, 4 deleted (10 B)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := changeCounts(test.new_count, test.changed_count, test.deleted_count, test.size)
+			if got != test.want {
+				t.Errorf("changeCounts() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
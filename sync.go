@@ -0,0 +1,551 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// repoSync is the state shared by the syncs of every repo in a run. Its
+// syncRepo method is safe to call from several goroutines at once.
+type repoSync struct {
+	c                *Config
+	files            []string
+	change_detect    changeDetect
+	soft_normalizers []softChangeNormalizer
+	source_sha       string
+	secret_scanner   *secretScanner
+	trace            *fileTrace
+	sarif            *sarifLog
+	changes          *changelog
+	select_files     bool
+
+	// Number of repos that would get a sync PR in a dry run
+	dry_run_prs atomic.Int32
+}
+
+// repoResult is the outcome of syncing a single repo, as written by
+// -output json.
+type repoResult struct {
+	Repo string `json:"repo"`
+	// Name of the sync set, only with sync_sets
+	Set string `json:"set,omitempty"`
+	// created, updated or closed when the sync PR was, skipped for archived
+	// or disabled repos, failed probes and ones not approved with
+	// -interactive and cancelled when the run was cancelled
+	Action string `json:"action,omitempty"`
+	// Why the repo was skipped
+	SkipReason   string   `json:"skip_reason,omitempty"`
+	PrNumber     int      `json:"pr_number,omitempty"`
+	PrUrl        string   `json:"pr_url,omitempty"`
+	NewFiles     []string `json:"new_files"`
+	ChangedFiles []string `json:"changed_files"`
+	DeletedFiles []string `json:"deleted_files"`
+	// Total size of the new and changed files
+	Bytes int64  `json:"bytes"`
+	Error string `json:"error,omitempty"`
+
+	err error
+}
+
+func newRepoResult(repo_name string) *repoResult {
+	return &repoResult{
+		Repo:         repo_name,
+		NewFiles:     []string{},
+		ChangedFiles: []string{},
+		DeletedFiles: []string{},
+	}
+}
+
+func (r *repoResult) setErr(err error) {
+	r.err = err
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// syncRepo clones repo_name, compares it against the managed files and opens
+// or updates its sync PR as needed, recording what was done in result.
+func (s *repoSync) syncRepo(repo_name string, result *repoResult) error {
+	c := s.c
+	trace := s.trace
+
+	clone_url := cloneUrl(c, repo_name)
+
+	inactive, err := inactiveReason(repo_name)
+	if err != nil {
+		return err
+	}
+	if inactive != "" {
+		logInfo("Skipping %s, the repo is %s", repo_name, inactive)
+		result.Action = "skipped"
+		result.SkipReason = inactive
+		return nil
+	}
+
+	mappings, err := resolveMappings(c, repo_name, filesForRepo(c, s.files, repo_name, trace), trace)
+	if err != nil {
+		return err
+	}
+
+	base_branch, err := baseBranch(c, repo_name)
+	if err != nil {
+		return err
+	}
+
+	var repo_head, source_key string
+	if hashCache != nil {
+		repo_head, err = remoteHead(clone_url, base_branch)
+		if err != nil {
+			return err
+		}
+		source_key, err = sourceKey(s.source_sha, mappings, s.change_detect)
+		if err != nil {
+			return err
+		}
+
+		cached, ok := hashCache.lookupDiff(repo_name, repo_head, source_key)
+		if ok && trace == nil && len(cached.NewFiles) == 0 && len(cached.ChangedFiles) == 0 && len(cached.DeletedFiles) == 0 {
+			logInfo("No changes for %s (cached)", repo_name)
+			return s.closeStalePr(repo_name, result)
+		}
+	}
+
+	if err := runCtx.Err(); err != nil {
+		return err
+	}
+
+	repo_clone_dir, cleanup, err := repoCloneDir(repo_name)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	repo, err := cloneRepo(repo_clone_dir, clone_url, base_branch)
+	if err != nil {
+		return err
+	}
+
+	probe_ok, err := runProbe(probeCommand(c, repo_name), repo_clone_dir)
+	if err != nil {
+		return err
+	}
+	if !probe_ok {
+		logInfo("%s: probe failed, skipping", repo_name)
+		result.Action = "skipped"
+		result.SkipReason = "probe failed"
+		return nil
+	}
+
+	if *reportUnmanaged {
+		candidates, err := unmanagedCandidates(repo_clone_dir, candidatePatterns(c, mappings), mappings)
+		if err != nil {
+			return err
+		}
+
+		for _, candidate := range candidates {
+			logInfo("%s: unmanaged candidate %s", repo_name, candidate)
+		}
+		return nil
+	}
+
+	files_diff, manifest, err := s.diffRepo(repo_name, repo_clone_dir, mappings, func(files_diff *FilesDiff) {
+		hashCache.storeDiff(repo_name, repo_head, source_key, files_diff)
+	})
+	if err != nil {
+		return err
+	}
+
+	if trace != nil {
+		trace.print(os.Stdout)
+		return nil
+	}
+
+	if s.sarif != nil {
+		s.sarif.addFilesDiff(repo_name, files_diff)
+		return nil
+	}
+
+	if len(files_diff.ChangedFiles) == 0 && len(files_diff.NewFiles) == 0 && len(files_diff.DeletedFiles) == 0 {
+		logInfo("No changes for %s", repo_name)
+		return s.closeStalePr(repo_name, result)
+	}
+
+	if onlyMetadata(c, diffPaths(files_diff)) {
+		logInfo("No changes for %s besides metadata", repo_name)
+		return s.closeStalePr(repo_name, result)
+	}
+
+	result.NewFiles = append(result.NewFiles, files_diff.NewFiles...)
+	result.ChangedFiles = append(result.ChangedFiles, files_diff.ChangedFiles...)
+	result.DeletedFiles = append(result.DeletedFiles, files_diff.DeletedFiles...)
+
+	if *dryRun || *checkDrift {
+		if *checkDrift {
+			logInfo("%s is out of sync:", repo_name)
+		} else {
+			logInfo("Would sync %s:", repo_name)
+		}
+		for _, new_file := range files_diff.NewFiles {
+			logInfo("  new %s", new_file)
+		}
+		for _, changed_file := range files_diff.ChangedFiles {
+			logInfo("  changed %s", changed_file)
+		}
+		for _, deleted_file := range files_diff.DeletedFiles {
+			logInfo("  deleted %s", deleted_file)
+		}
+		result.Bytes, err = logSyncSummary(repo_name, files_diff)
+		if err != nil {
+			return err
+		}
+		if *patchDir != "" {
+			err = writePatch(*patchDir, c, repo_name, repo_clone_dir, files_diff)
+			if err != nil {
+				return err
+			}
+		}
+		if *checkDrift {
+			drifted := len(files_diff.NewFiles) + len(files_diff.ChangedFiles) + len(files_diff.DeletedFiles)
+			return fmt.Errorf("out of sync, %d files differ", drifted)
+		}
+		s.dry_run_prs.Add(1)
+		return nil
+	}
+
+	if *classifyOnly {
+		classes, err := classifyChanges(s.soft_normalizers, repo_clone_dir, files_diff)
+		if err != nil {
+			return err
+		}
+
+		for _, new_file := range files_diff.NewFiles {
+			logInfo("%s: new %s", repo_name, new_file)
+		}
+		for _, changed_file := range files_diff.ChangedFiles {
+			logInfo("%s: %s-change %s", repo_name, classes[changed_file], changed_file)
+		}
+		return nil
+	}
+
+	// Files the user approved and deselected with -interactive, approved is
+	// nil without it
+	var approved map[string]bool
+	deselected := map[string]bool{}
+	if s.select_files {
+		for _, file_rel := range diffPaths(files_diff) {
+			deselected[file_rel] = true
+		}
+		ok, err := interactiveReview(repo_name, repo_clone_dir, files_diff)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			logInfo("Skipping %s, not approved", repo_name)
+			*result = *newRepoResult(repo_name)
+			result.Set = c.SetName
+			result.Action = "skipped"
+			result.SkipReason = "not approved"
+			return nil
+		}
+		approved = map[string]bool{}
+		for _, file_rel := range diffPaths(files_diff) {
+			approved[file_rel] = true
+			delete(deselected, file_rel)
+		}
+		result.NewFiles = append([]string{}, files_diff.NewFiles...)
+		result.ChangedFiles = append([]string{}, files_diff.ChangedFiles...)
+		result.DeletedFiles = append([]string{}, files_diff.DeletedFiles...)
+
+		if len(files_diff.ChangedFiles) == 0 && len(files_diff.NewFiles) == 0 && len(files_diff.DeletedFiles) == 0 {
+			logInfo("No files selected for %s", repo_name)
+			return nil
+		}
+	}
+
+	if s.secret_scanner != nil {
+		err = s.secret_scanner.check(files_diff)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := runCtx.Err(); err != nil {
+		return err
+	}
+
+	logInfo("::group::%s", repo_name)
+	defer logInfo("::endgroup::")
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	branch_name := c.syncBranch(repo_name)
+
+	pr_num, err := prClient.FindPr(repo_name, branch_name, c.PrTitle, c.AuthorLogin)
+	if err != nil {
+		return fmt.Errorf("PR step failed: %w", err)
+	}
+
+	// An open PR's branch is stacked on so earlier commits (and any pushed by
+	// reviewers) survive. Without a PR the branch is recreated from HEAD.
+	stacked, err := checkoutSyncBranch(repo, worktree, repo_clone_dir, branch_name, pr_num != nil)
+	if err != nil {
+		return err
+	}
+	if stacked {
+		// The diff so far is against the base branch. The stacked branch may
+		// already hold some of the changes, or ones since reverted in the
+		// managed files, so everything below works from a fresh diff of it.
+		files_diff, manifest, err = s.diffRepo(repo_name, repo_clone_dir, mappings, nil)
+		if err != nil {
+			return err
+		}
+		if approved != nil {
+			// Only what the user approved, changes that only show up
+			// against the stacked branch weren't reviewed
+			for _, file_rel := range diffPaths(files_diff) {
+				if !approved[file_rel] {
+					deselected[file_rel] = true
+				}
+			}
+			applySelection(files_diff, approved)
+		}
+
+		result.NewFiles = append([]string{}, files_diff.NewFiles...)
+		result.ChangedFiles = append([]string{}, files_diff.ChangedFiles...)
+		result.DeletedFiles = append([]string{}, files_diff.DeletedFiles...)
+	}
+
+	pr_body, err := prBody(c, repo_name, s.source_sha, repo_clone_dir, files_diff)
+	if err != nil {
+		return err
+	}
+	category := dominantCategory(c.ChangeCategories, files_diff)
+
+	result.Bytes, err = logSyncSummary(repo_name, files_diff)
+	if err != nil {
+		return err
+	}
+	if *patchDir != "" {
+		err = writePatch(*patchDir, c, repo_name, repo_clone_dir, files_diff)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = copyFiles(files_diff, repo_clone_dir, files_diff.NewFiles)
+	if err != nil {
+		return err
+	}
+	for _, new_file := range files_diff.NewFiles {
+		logInfo("new %s", new_file)
+	}
+
+	err = copyFiles(files_diff, repo_clone_dir, files_diff.ChangedFiles)
+	if err != nil {
+		return err
+	}
+	for _, changed_file := range files_diff.ChangedFiles {
+		logInfo("changed %s", changed_file)
+	}
+
+	for _, deleted_file := range files_diff.DeletedFiles {
+		_, err = os.Lstat(filepath.Join(repo_clone_dir, deleted_file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		_, err = worktree.Remove(deleted_file)
+		if err != nil {
+			return err
+		}
+		logInfo("deleted %s", deleted_file)
+	}
+
+	legacy_list, err := writeRepoManifest(repo_clone_dir, c, mappings, manifest, deselected)
+	if err != nil {
+		return err
+	}
+	if legacy_list != "" {
+		_, err = worktree.Remove(legacy_list)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Snapshots {
+		err = writeSnapshots(repo_clone_dir, files_diff)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = runPostSyncCommands(c.PostSyncCommands, repo_clone_dir)
+	if err != nil {
+		return err
+	}
+
+	// E.g. a post sync formatter may have undone every real change
+	changed, err := changedPaths(worktree)
+	if err != nil {
+		return err
+	}
+	if onlyMetadata(c, changed) {
+		logInfo("No changes for %s besides metadata, not committing", repo_name)
+		*result = *newRepoResult(repo_name)
+		result.Set = c.SetName
+		return nil
+	}
+
+	signature, err := newSignature(c, time.Now())
+	if err != nil {
+		return err
+	}
+
+	commit_message, err := renderCommitMessage(c, repo_name, s.source_sha, files_diff)
+	if err != nil {
+		return err
+	}
+	if c.Signoff || *signoff {
+		commit_message = appendSignoff(commit_message, signature)
+	}
+
+	var action string
+	if pr_num == nil {
+		var created_num int
+		created_num, result.PrUrl, err = createPr(repo_name, repo_clone_dir, branch_name, base_branch, repo, worktree, c.PrTitle, pr_body, commit_message, signature)
+		pr_num = &created_num
+		action = "created"
+	} else {
+		var updated bool
+		updated, err = updatePr(repo_name, repo_clone_dir, *pr_num, branch_name, repo, worktree, commit_message, signature, pr_body, c.RespectReviews && !*forceUpdate, !stacked)
+		if updated {
+			action = "updated"
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("PR step failed: %w", err)
+	}
+
+	result.PrNumber = *pr_num
+	if result.PrUrl == "" {
+		result.PrUrl, err = prClient.ViewPrUrl(repo_name, *pr_num)
+		if err != nil || result.PrUrl == "" {
+			logWarn("resolving the URL of %s#%d failed: %v", repo_name, *pr_num, err)
+			result.PrUrl = prWebUrl(repo_name, *pr_num)
+		}
+	}
+	applyPrMetadata(c, repo_name, *pr_num, action == "created")
+	if action == "" {
+		return nil
+	}
+	result.Action = action
+
+	s.changes.add(repo_name, c.FilesDir, files_diff)
+	if category != nil && len(category.Reviewers) > 0 {
+		err = prClient.RequestReviewers(repo_name, *pr_num, category.Reviewers)
+		if err != nil {
+			logWarn("requesting %s review for %s failed: %s", category.Name, repo_name, err)
+		}
+	}
+	if c.Dispatch.EventType != "" {
+		sendDispatch(repo_name, newDispatchPayload(
+			c.Dispatch.EventType, repo_name, *pr_num, action, files_diff,
+		))
+	}
+	if c.TrackerWebhook.URL != "" {
+		sendTracker(c.TrackerWebhook, newTrackerPayload(
+			repo_name, *pr_num, action, files_diff,
+		))
+	}
+
+	return nil
+}
+
+// diffRepo compares the clone in repo_clone_dir, as currently checked out,
+// against mappings and filters out the changes the repo keeps to itself.
+// Also returns the manifest read from the clone. store, when not nil, gets
+// the diff before filtering for the compare cache.
+func (s *repoSync) diffRepo(
+	repo_name string,
+	repo_clone_dir string,
+	mappings []fileMapping,
+	store func(*FilesDiff),
+) (*FilesDiff, map[string]repoManifestFile, error) {
+	c := s.c
+	trace := s.trace
+
+	manifest, err := readRepoManifest(repo_clone_dir, c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading the manifest: %w", err)
+	}
+
+	files_diff, err := getFilesDiff(repo_clone_dir, manifest, mappings, c.excludeGlobs(repo_name), s.change_detect, trace)
+	if err != nil {
+		return nil, nil, err
+	}
+	if store != nil {
+		store(files_diff)
+	}
+
+	if c.CheckLicense && !*allowLicenseChange {
+		err = filterLicenseChanges(repo_clone_dir, files_diff, trace)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = filterModifiedFiles(repo_name, repo_clone_dir, manifest, files_diff, trace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.Snapshots {
+		err = filterSnapshotConflicts(repo_name, repo_clone_dir, files_diff, trace)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return files_diff, manifest, nil
+}
+
+// diffPaths returns the new, changed and deleted paths of files_diff.
+func diffPaths(files_diff *FilesDiff) []string {
+	paths := append(slices.Clone(files_diff.NewFiles), files_diff.ChangedFiles...)
+	return append(paths, files_diff.DeletedFiles...)
+}
+
+// applyPrMetadata adds the configured labels to sync PR pr_num and, when it
+// was just created, requests the configured reviewers and assignees. Failures,
+// e.g. a label missing from the repo, only warn.
+func applyPrMetadata(c *Config, repo_name string, pr_num int, created bool) {
+	for _, label := range c.Labels {
+		err := prClient.AddLabel(repo_name, pr_num, label)
+		if err != nil {
+			logWarn("skipping label %q for %s#%d: %s", label, repo_name, pr_num, err)
+		}
+	}
+
+	if !created {
+		return
+	}
+
+	if len(c.Reviewers) > 0 {
+		err := prClient.RequestReviewers(repo_name, pr_num, c.Reviewers)
+		if err != nil {
+			logWarn("requesting review for %s#%d failed: %s", repo_name, pr_num, err)
+		}
+	}
+	if len(c.Assignees) > 0 {
+		err := prClient.AddAssignees(repo_name, pr_num, c.Assignees)
+		if err != nil {
+			logWarn("assigning %s#%d failed: %s", repo_name, pr_num, err)
+		}
+	}
+}
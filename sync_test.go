@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePrClient records the PRs of a sync instead of talking to GitHub.
+type fakePrClient struct {
+	// Open PR number by branch
+	prs    map[string]int
+	bodies map[int]string
+	// Branches PRs were created from
+	created []string
+}
+
+func newFakePrClient() *fakePrClient {
+	return &fakePrClient{prs: map[string]int{}, bodies: map[int]string{}}
+}
+
+func (f *fakePrClient) FindPr(repo string, branch string, title string, author string) (*int, error) {
+	if num, ok := f.prs[branch]; ok {
+		return &num, nil
+	}
+	return nil, nil
+}
+
+func (f *fakePrClient) CreatePr(repo string, branch string, base string, title string, body string) (int, string, error) {
+	num := len(f.created) + 1
+	f.prs[branch] = num
+	f.bodies[num] = body
+	f.created = append(f.created, branch)
+	return num, prWebUrl(repo, num), nil
+}
+
+func (f *fakePrClient) EnableAutoMerge(repo string, branch string) error { return nil }
+
+func (f *fakePrClient) RequestReviewers(repo string, pr_num int, reviewers []string) error {
+	return nil
+}
+
+func (f *fakePrClient) AddLabel(repo string, pr_num int, label string) error { return nil }
+
+func (f *fakePrClient) AddAssignees(repo string, pr_num int, assignees []string) error {
+	return nil
+}
+
+func (f *fakePrClient) ViewPrBody(repo string, pr_num int) (string, error) {
+	return f.bodies[pr_num], nil
+}
+
+func (f *fakePrClient) ViewPrUrl(repo string, pr_num int) (string, error) {
+	return prWebUrl(repo, pr_num), nil
+}
+
+func (f *fakePrClient) EditPrBody(repo string, pr_num int, body string) error {
+	f.bodies[pr_num] = body
+	return nil
+}
+
+func (f *fakePrClient) UnresolvedReviewThreads(repo string, pr_num int) (int, error) {
+	return 0, nil
+}
+
+func (f *fakePrClient) ViewRepo(repo string) (repoView, error) {
+	return repoView{DefaultBranch: "main"}, nil
+}
+
+// testGit runs git in dir, failing the test on errors.
+func testGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// newTestRemote creates a bare repo with a main branch holding files.
+func newTestRemote(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.git")
+	work := filepath.Join(dir, "work")
+
+	testGit(t, dir, "init", "-q", "--bare", "-b", "main", remote)
+	testGit(t, dir, "clone", "-q", remote, work)
+	for file_rel, content := range files {
+		writeTestFile(t, filepath.Join(work, file_rel), content, 0644)
+	}
+	testGit(t, work, "add", "-A")
+	testGit(t, work, "commit", "-q", "-m", "init")
+	testGit(t, work, "push", "-q", "origin", "main")
+	return remote
+}
+
+// TestSyncRepo syncs managed files into a local bare repo with a fake PR
+// backend, checking the pushed commit, then updates the open PR.
+func TestSyncRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	remote := newTestRemote(t, map[string]string{
+		"README.md":     "# alpha\n",
+		".editorconfig": "old\n",
+	})
+
+	files_dir := t.TempDir()
+	writeTestFile(t, filepath.Join(files_dir, ".editorconfig"), "new\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "scripts", "lint.sh"), "#!/bin/sh\n", 0755)
+
+	fake := newFakePrClient()
+	defer func(client PrClient, inactive func(string) (string, error)) {
+		prClient = client
+		inactiveReason = inactive
+	}(prClient, inactiveReason)
+	prClient = fake
+	inactiveReason = func(string) (string, error) { return "", nil }
+
+	c := &Config{
+		PrTitle:     "chore: sync with ecsact_common",
+		FilesDir:    files_dir,
+		AuthorLogin: "seaubot",
+		AuthorEmail: "seaubot@example.com",
+		CloneUrl:    "file://" + filepath.ToSlash(filepath.Dir(remote)) + "/{repo}.git",
+		BaseBranch:  "main",
+		Repos:       []string{"remote"},
+	}
+	files, err := managedFiles(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change_detect, err := parseChangeDetect(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &repoSync{c: c, files: files, change_detect: change_detect}
+	branch := c.syncBranch("remote")
+
+	result := newRepoResult("remote")
+	err = s.syncRepo("remote", result)
+	if err != nil {
+		t.Fatalf("syncRepo() failed: %v", err)
+	}
+
+	if result.Action != "created" || result.PrNumber != 1 {
+		t.Errorf("syncRepo() action %q PR %d, want created PR 1", result.Action, result.PrNumber)
+	}
+	if strings.Join(result.NewFiles, ",") != "scripts/lint.sh" || strings.Join(result.ChangedFiles, ",") != ".editorconfig" {
+		t.Errorf("syncRepo() synced new %v changed %v", result.NewFiles, result.ChangedFiles)
+	}
+	if len(fake.created) != 1 || fake.created[0] != branch {
+		t.Errorf("created PRs from %v, want %s", fake.created, branch)
+	}
+
+	if got := testGit(t, remote, "show", branch+":.editorconfig"); got != "new" {
+		t.Errorf("pushed .editorconfig = %q, want new", got)
+	}
+	if got := testGit(t, remote, "ls-tree", branch, "scripts/lint.sh"); !strings.HasPrefix(got, "100755 ") {
+		t.Errorf("pushed scripts/lint.sh as %q, want it executable", got)
+	}
+	if got := testGit(t, remote, "log", "-1", "--format=%an <%ae>", branch); got != "seaubot <seaubot@example.com>" {
+		t.Errorf("sync commit author = %q", got)
+	}
+	if got := testGit(t, remote, "rev-parse", branch+"^"); got != testGit(t, remote, "rev-parse", "main") {
+		t.Errorf("sync commit parent = %s, want the tip of main", got)
+	}
+	if !strings.Contains(testGit(t, remote, "show", branch+":"+repoManifestPath), `"scripts/lint.sh"`) {
+		t.Errorf("pushed manifest doesn't list scripts/lint.sh")
+	}
+
+	// Nothing changed, the open PR is left alone
+	first_tip := testGit(t, remote, "rev-parse", branch)
+	result = newRepoResult("remote")
+	err = s.syncRepo("remote", result)
+	if err != nil {
+		t.Fatalf("second syncRepo() failed: %v", err)
+	}
+	if result.Action != "" {
+		t.Errorf("second syncRepo() action = %q, want none", result.Action)
+	}
+	if got := testGit(t, remote, "rev-parse", branch); got != first_tip {
+		t.Errorf("second syncRepo() moved %s to %s", branch, got)
+	}
+
+	// Reverting a managed file to the content of main is stacked on the PR
+	writeTestFile(t, filepath.Join(files_dir, ".editorconfig"), "old\n", 0644)
+	result = newRepoResult("remote")
+	err = s.syncRepo("remote", result)
+	if err != nil {
+		t.Fatalf("third syncRepo() failed: %v", err)
+	}
+	if result.Action != "updated" {
+		t.Errorf("third syncRepo() action = %q, want updated", result.Action)
+	}
+	if got := testGit(t, remote, "show", branch+":.editorconfig"); got != "old" {
+		t.Errorf("stacked .editorconfig = %q, want old", got)
+	}
+	if got := testGit(t, remote, "rev-parse", branch+"^"); got != first_tip {
+		t.Errorf("stacked commit parent = %s, want %s", got, first_tip)
+	}
+	if len(fake.created) != 1 {
+		t.Errorf("created %d PRs, want 1", len(fake.created))
+	}
+}
+
+// TestSyncRepoInteractiveStacked checks that stacking on an open PR only
+// syncs the files approved with -interactive, not changes that only show up
+// against the sync branch.
+func TestSyncRepoInteractiveStacked(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	remote := newTestRemote(t, map[string]string{".editorconfig": "old\n"})
+	files_dir := t.TempDir()
+	writeTestFile(t, filepath.Join(files_dir, ".editorconfig"), "new\n", 0644)
+
+	defer func(client PrClient, inactive func(string) (string, error), in *bufio.Reader) {
+		prClient = client
+		inactiveReason = inactive
+		stdinReader = in
+	}(prClient, inactiveReason, stdinReader)
+	prClient = newFakePrClient()
+	inactiveReason = func(string) (string, error) { return "", nil }
+
+	c := &Config{
+		PrTitle:     "chore: sync with ecsact_common",
+		FilesDir:    files_dir,
+		AuthorLogin: "seaubot",
+		CloneUrl:    "file://" + filepath.ToSlash(filepath.Dir(remote)) + "/{repo}.git",
+		BaseBranch:  "main",
+		Repos:       []string{"remote"},
+	}
+	change_detect, err := parseChangeDetect(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sync := func(select_files bool) *repoResult {
+		t.Helper()
+		files, err := managedFiles(c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &repoSync{c: c, files: files, change_detect: change_detect, select_files: select_files}
+		result := newRepoResult("remote")
+		err = s.syncRepo("remote", result)
+		if err != nil {
+			t.Fatalf("syncRepo() failed: %v", err)
+		}
+		return result
+	}
+	branch := c.syncBranch("remote")
+
+	sync(false)
+
+	// .editorconfig is back to the content of main so it isn't offered for
+	// review, only docs.txt is
+	writeTestFile(t, filepath.Join(files_dir, ".editorconfig"), "old\n", 0644)
+	writeTestFile(t, filepath.Join(files_dir, "docs.txt"), "docs\n", 0644)
+	stdinReader = bufio.NewReader(strings.NewReader("y\n"))
+	result := sync(true)
+
+	if strings.Join(result.NewFiles, ",") != "docs.txt" || len(result.ChangedFiles) != 0 {
+		t.Errorf("syncRepo() synced new %v changed %v, want only docs.txt", result.NewFiles, result.ChangedFiles)
+	}
+	if got := testGit(t, remote, "show", branch+":docs.txt"); got != "docs" {
+		t.Errorf("pushed docs.txt = %q, want docs", got)
+	}
+	if got := testGit(t, remote, "show", branch+":.editorconfig"); got != "new" {
+		t.Errorf("pushed .editorconfig = %q, want the unapproved revert left out", got)
+	}
+}
+
+// TestSyncAllDeadline checks that repos aren't started once -deadline has
+// passed or the run was cancelled.
+func TestSyncAllDeadline(t *testing.T) {
+	defer func(d time.Duration, ctx context.Context) {
+		*deadline = d
+		runCtx = ctx
+	}(*deadline, runCtx)
+	*deadline = time.Minute
+
+	cancelled_ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		// How long the run has already taken
+		elapsed       time.Duration
+		wantCancelled []string
+		wantLog       string
+	}{
+		{
+			name:    "deadline exceeded",
+			ctx:     context.Background(),
+			elapsed: time.Hour,
+			wantLog: "Deadline of 1m0s exceeded, not processed: ecsact_cli, ecsact_runtime",
+		},
+		{
+			name:          "cancelled",
+			ctx:           cancelled_ctx,
+			wantCancelled: []string{"ecsact_cli", "ecsact_runtime"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runCtx = test.ctx
+			c := &Config{Repos: []string{"ecsact_cli", "ecsact_runtime"}}
+			s := &repoSync{c: c}
+
+			var outcome *syncOutcome
+			output := captureStdout(t, func() {
+				outcome = s.syncAll(1, time.Now().Add(-test.elapsed))
+			})
+
+			if len(outcome.succeeded) != 0 || len(outcome.failures) != 0 {
+				t.Errorf("syncAll() past the deadline processed repos: %+v", outcome)
+			}
+			if !slices.Equal(outcome.cancelled, test.wantCancelled) {
+				t.Errorf("syncAll() cancelled %v, want %v", outcome.cancelled, test.wantCancelled)
+			}
+			if test.wantLog == "" && strings.Contains(output, "Deadline") {
+				t.Errorf("syncAll() logged %q, want no deadline", output)
+			}
+			if !strings.Contains(output, test.wantLog) {
+				t.Errorf("syncAll() logged %q, want %q", output, test.wantLog)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// File at the root of FilesDir listing paths in gitignore syntax that aren't
+// managed files, e.g. editor backups. It's never synced itself.
+const syncIgnoreFile = ".ecsactsyncignore"
+
+// readSyncIgnore parses the syncIgnoreFile of files_dir, returning nil if
+// there is none.
+func readSyncIgnore(files_dir string) (gitignore.Matcher, error) {
+	f, err := os.Open(filepath.Join(files_dir, syncIgnoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []gitignore.Pattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return gitignore.NewMatcher(patterns), nil
+}
+
+// syncIgnored reports whether file_rel, relative to FilesDir, is excluded by
+// ignore or is the syncIgnoreFile itself.
+func syncIgnored(ignore gitignore.Matcher, file_rel string, is_dir bool) bool {
+	file_rel = filepath.ToSlash(file_rel)
+	if file_rel == syncIgnoreFile {
+		return true
+	}
+	return ignore != nil && ignore.Match(strings.Split(file_rel, "/"), is_dir)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncIgnored(t *testing.T) {
+	files_dir := t.TempDir()
+	writeTestFile(t, filepath.Join(files_dir, syncIgnoreFile), `# editor backups
+*.bak
+
+build/
+/TODO
+docs/**/*.draft.md
+!keep.bak
+`, 0644)
+
+	ignore, err := readSyncIgnore(files_dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file_rel string
+		is_dir   bool
+		want     bool
+	}{
+		{file_rel: syncIgnoreFile, want: true},
+		{file_rel: "a.txt", want: false},
+		{file_rel: "a.bak", want: true},
+		{file_rel: "sub/a.bak", want: true},
+		{file_rel: "keep.bak", want: false},
+		{file_rel: "build", is_dir: true, want: true},
+		{file_rel: "build", is_dir: false, want: false},
+		{file_rel: "sub/build", is_dir: true, want: true},
+		{file_rel: "TODO", want: true},
+		{file_rel: "sub/TODO", want: false},
+		{file_rel: "docs/a/b/intro.draft.md", want: true},
+		{file_rel: "docs/intro.md", want: false},
+		{file_rel: filepath.Join("sub", "a.bak"), want: true},
+		{file_rel: "# editor backups", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file_rel, func(t *testing.T) {
+			if got := syncIgnored(ignore, test.file_rel, test.is_dir); got != test.want {
+				t.Errorf("syncIgnored(%q, %v) = %v, want %v", test.file_rel, test.is_dir, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSyncIgnoredWithoutIgnoreFile(t *testing.T) {
+	ignore, err := readSyncIgnore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ignore != nil {
+		t.Fatal("readSyncIgnore() returned a matcher without an ignore file")
+	}
+
+	if syncIgnored(ignore, "a.bak", false) {
+		t.Error("syncIgnored() ignored a file without an ignore file")
+	}
+	if !syncIgnored(ignore, syncIgnoreFile, false) {
+		t.Error("syncIgnored() didn't ignore the ignore file itself")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// SyncSet is an independent group of managed files synced to its repos with
+// a PR of its own, e.g. CI workflows apart from editor config. Fields left
+// empty fall back to the top level config.
+type SyncSet struct {
+	Name     string `yaml:"name"`
+	FilesDir string `yaml:"files_dir"`
+	PrTitle  string `yaml:"pr_title"`
+	// Defaults to the top level branch_name suffixed with -<name>
+	BranchName    string `yaml:"branch_name"`
+	CommitMessage string `yaml:"commit_message"`
+	PrBody        string `yaml:"pr_body"`
+	// Names of the configured repos the set is synced to, along with the
+	// repos of Tiers of the repos_url inventory. All of them when both are
+	// empty.
+	Repos []string `yaml:"repos"`
+	Tiers []string `yaml:"tiers"`
+}
+
+// validateSyncSets reports the problems of the configured sync sets.
+func (c *Config) validateSyncSets() []string {
+	var problems []string
+	names := map[string]bool{}
+	for i, set := range c.SyncSets {
+		if set.Name == "" {
+			problems = append(problems, fmt.Sprintf("sync_sets[%d]: name is required", i))
+		} else if names[set.Name] {
+			problems = append(problems, fmt.Sprintf("sync_sets[%d]: duplicate name %q", i, set.Name))
+		}
+		names[set.Name] = true
+
+		if set.PrTitle == "" && c.PrTitle == "" {
+			problems = append(problems, fmt.Sprintf("sync_sets[%d]: pr_title is required", i))
+		}
+		if set.FilesDir == "" && c.FilesDir == "" {
+			problems = append(problems, fmt.Sprintf("sync_sets[%d]: files_dir is required", i))
+		} else if set.FilesDir != "" {
+			problems = append(problems, checkFilesDir(fmt.Sprintf("sync_sets[%d]: files_dir", i), set.FilesDir)...)
+		}
+	}
+	return problems
+}
+
+// checkSyncSets fails when a sync set targets a repo that isn't configured.
+func checkSyncSets(c *Config) error {
+	for _, set := range c.SyncSets {
+		for _, repo := range set.Repos {
+			if !slices.Contains(c.Repos, repo) {
+				return fmt.Errorf("sync_sets %s: %q is not a configured repo", set.Name, repo)
+			}
+		}
+	}
+	return nil
+}
+
+// syncSetConfigs returns a config per sync set, each a copy of c with the
+// fields of the set applied, or just c without sync sets. A non empty only
+// selects a single set by name.
+func (c *Config) syncSetConfigs(only string) ([]*Config, error) {
+	if len(c.SyncSets) == 0 {
+		if only != "" {
+			return nil, fmt.Errorf("-sync-set %q: the config has no sync_sets", only)
+		}
+		return []*Config{c}, nil
+	}
+
+	var configs []*Config
+	for _, set := range c.SyncSets {
+		if only != "" && set.Name != only {
+			continue
+		}
+
+		set_config := *c
+		set_config.SetName = set.Name
+		if set.FilesDir != "" {
+			set_config.FilesDir = set.FilesDir
+		}
+		if set.PrTitle != "" {
+			set_config.PrTitle = set.PrTitle
+		}
+		if set.BranchName != "" {
+			set_config.BranchName = set.BranchName
+		} else {
+			set_config.BranchName = c.syncBranchTemplate() + "-" + set.Name
+		}
+		if set.CommitMessage != "" {
+			set_config.CommitMessage = set.CommitMessage
+		}
+		if set.PrBody != "" {
+			set_config.PrBody = set.PrBody
+		}
+		if len(set.Repos) > 0 || len(set.Tiers) > 0 {
+			set_config.Repos = nil
+			for _, repo_name := range c.Repos {
+				if slices.Contains(set.Repos, repo_name) || inTiers(c, repo_name, set.Tiers) {
+					set_config.Repos = append(set_config.Repos, repo_name)
+				}
+			}
+		}
+		configs = append(configs, &set_config)
+	}
+
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("-sync-set: no sync set named %q", only)
+	}
+
+	// Sets sharing a branch would overwrite each other's PR
+	branches := map[string]string{}
+	for _, set_config := range configs {
+		branch := set_config.syncBranchTemplate()
+		if other, ok := branches[branch]; ok {
+			return nil, fmt.Errorf("sync sets %s and %s both use the branch %s", other, set_config.SetName, branch)
+		}
+		branches[branch] = set_config.SetName
+	}
+
+	return configs, nil
+}
+
+// resolveSyncSetDirs makes the files_dir of each sync set relative to the
+// config file like the top level one.
+func (c *Config) resolveSyncSetDirs(config_dir string) {
+	for i := range c.SyncSets {
+		files_dir := c.SyncSets[i].FilesDir
+		if files_dir != "" && !filepath.IsAbs(files_dir) {
+			c.SyncSets[i].FilesDir = filepath.Join(config_dir, files_dir)
+		}
+	}
+}
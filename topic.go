@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// topicRepos lists the non archived repos of the org tagged with topic.
+func topicRepos(topic string) ([]InventoryRepo, error) {
+	output, err := runGh(
+		"repo", "list", githubOrg,
+		"--topic", topic,
+		"--no-archived",
+		"--limit", "1000",
+		"--json", "name,defaultBranchRef",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var listed []struct {
+		Name             string `json:"name"`
+		DefaultBranchRef struct {
+			Name string `json:"name"`
+		} `json:"defaultBranchRef"`
+	}
+	err = json.Unmarshal(output, &listed)
+	if err != nil {
+		return nil, fmt.Errorf("parsing repos with topic %s: %w", topic, err)
+	}
+
+	repos := make([]InventoryRepo, 0, len(listed))
+	for _, repo := range listed {
+		repos = append(repos, InventoryRepo{
+			Name:          repo.Name,
+			DefaultBranch: repo.DefaultBranchRef.Name,
+		})
+	}
+	return repos, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// TrackerWebhookConfig enables posting the details of each created or updated
+// sync PR to an external tracker.
+type TrackerWebhookConfig struct {
+	URL string `yaml:"url"`
+	// Headers sent with every request. Values have environment variables
+	// expanded so tokens don't need to be committed.
+	Headers map[string]string `yaml:"headers"`
+}
+
+type trackerPayload struct {
+	Repo         string   `json:"repo"`
+	PrNumber     int      `json:"pr_number"`
+	PrUrl        string   `json:"pr_url"`
+	Action       string   `json:"action"`
+	NewFiles     []string `json:"new_files"`
+	ChangedFiles []string `json:"changed_files"`
+}
+
+func newTrackerPayload(
+	repo_name string,
+	pr_num int,
+	action string,
+	files_diff *FilesDiff,
+) trackerPayload {
+	return trackerPayload{
+		Repo:         repo_name,
+		PrNumber:     pr_num,
+		PrUrl:        prWebUrl(repo_name, pr_num),
+		Action:       action,
+		NewFiles:     append([]string{}, files_diff.NewFiles...),
+		ChangedFiles: append([]string{}, files_diff.ChangedFiles...),
+	}
+}
+
+func postTracker(c TrackerWebhookConfig, payload trackerPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(runCtx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range c.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", c.URL, res.Status)
+	}
+	return nil
+}
+
+// sendTracker posts payload to the tracker webhook. Failures are only logged
+// since the sync itself already succeeded.
+func sendTracker(c TrackerWebhookConfig, payload trackerPayload) {
+	err := postTracker(c, payload)
+	if err != nil {
+		logWarn("tracker webhook for %s failed: %s", payload.Repo, err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewTrackerPayload(t *testing.T) {
+	files_diff := &FilesDiff{NewFiles: []string{"a.txt"}}
+	payload := newTrackerPayload("ecsact_cli", 12, "created", files_diff)
+
+	got, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"repo":"ecsact_cli","pr_number":12,"pr_url":"https://github.com/ecsact-dev/ecsact_cli/pull/12",` +
+		`"action":"created","new_files":["a.txt"],"changed_files":[]}`
+	if string(got) != want {
+		t.Errorf("newTrackerPayload() = %s, want %s", got, want)
+	}
+
+	// The payload must not share the diff's slices
+	files_diff.NewFiles[0] = "b.txt"
+	if payload.NewFiles[0] != "a.txt" {
+		t.Errorf("newTrackerPayload() new files changed with the diff to %v", payload.NewFiles)
+	}
+}
+
+func TestPostTracker(t *testing.T) {
+	t.Setenv("TRACKER_TOKEN", "secret")
+
+	tests := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "accepted", status: http.StatusAccepted},
+		{name: "rejected", status: http.StatusUnauthorized, wantErr: "401 Unauthorized"},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: "500 Internal Server Error"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got trackerPayload
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("tracker got %s, want POST", r.Method)
+				}
+				if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+					t.Errorf("tracker got Authorization %q, want the expanded token", auth)
+				}
+				if content_type := r.Header.Get("Content-Type"); content_type != "application/json" {
+					t.Errorf("tracker got Content-Type %q", content_type)
+				}
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Errorf("tracker got invalid JSON %q: %v", body, err)
+				}
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			c := TrackerWebhookConfig{
+				URL:     server.URL,
+				Headers: map[string]string{"Authorization": "Bearer ${TRACKER_TOKEN}"},
+			}
+			payload := newTrackerPayload("ecsact_cli", 12, "updated", &FilesDiff{ChangedFiles: []string{"a.txt"}})
+			err := postTracker(c, payload)
+
+			if test.wantErr == "" && err != nil {
+				t.Errorf("postTracker() failed: %v", err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("postTracker() = %v, want an error containing %q", err, test.wantErr)
+			}
+			if got.Repo != "ecsact_cli" || got.PrNumber != 12 || got.Action != "updated" {
+				t.Errorf("tracker got %+v, want the payload", got)
+			}
+		})
+	}
+}
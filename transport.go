@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// Auth used by go-git clones and fetches, nil for https where credentials are
+// part of the URL.
+var gitAuth transport.AuthMethod
+
+// Extra environment of git subprocesses so pushes use the same credentials as
+// go-git.
+var gitEnv []string
+
+// setupTransport configures gitAuth and gitEnv for transport_name, https or
+// ssh. Over ssh key_file is used if set, the ssh agent otherwise.
+func setupTransport(transport_name string, key_file string) error {
+	switch transport_name {
+	case "https":
+		return nil
+	case "ssh":
+	default:
+		return fmt.Errorf("unknown transport %q, expected https or ssh", transport_name)
+	}
+
+	if key_file == "" {
+		auth, err := ssh.NewSSHAgentAuth("git")
+		if err != nil {
+			return fmt.Errorf("ssh agent: %w", err)
+		}
+		gitAuth = auth
+		return nil
+	}
+
+	auth, err := ssh.NewPublicKeysFromFile("git", key_file, os.Getenv("SSH_KEY_PASSWORD"))
+	if err != nil {
+		return fmt.Errorf("ssh key %s: %w", key_file, err)
+	}
+	gitAuth = auth
+	gitEnv = append(gitEnv, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %q -o IdentitiesOnly=yes", key_file))
+	return nil
+}
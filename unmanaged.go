@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// candidatePatterns returns the path globs describing files that could be
+// managed. Without configured managed_patterns every non root directory
+// containing a managed file is used.
+func candidatePatterns(c *Config, mappings []fileMapping) []string {
+	if len(c.ManagedPatterns) > 0 {
+		return c.ManagedPatterns
+	}
+
+	var patterns []string
+	for _, mapping := range mappings {
+		dir := path.Dir(mapping.Dest)
+		if dir == "." {
+			continue
+		}
+		pattern := dir + "/*"
+		if !slices.Contains(patterns, pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// unmanagedCandidates lists files in repo_dir matching patterns that aren't
+// one of the managed files synced to it.
+func unmanagedCandidates(repo_dir string, patterns []string, mappings []fileMapping) ([]string, error) {
+	managed := map[string]bool{}
+	for _, mapping := range mappings {
+		managed[mapping.Dest] = true
+	}
+
+	var candidates []string
+	err := filepath.WalkDir(repo_dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		file_rel, err := filepath.Rel(repo_dir, file)
+		if err != nil {
+			return err
+		}
+		file_rel = filepath.ToSlash(file_rel)
+
+		if !managed[file_rel] && matchAnyGlob(patterns, file_rel) {
+			candidates = append(candidates, file_rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(candidates)
+	return candidates, nil
+}
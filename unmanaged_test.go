@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCandidatePatterns(t *testing.T) {
+	mappings := []fileMapping{
+		{Dest: "README.md"},
+		{Dest: ".github/workflows/main.yml"},
+		{Dest: ".github/workflows/release.yml"},
+		{Dest: "scripts/lint.sh"},
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{name: "derived", want: []string{".github/workflows/*", "scripts/*"}},
+		{name: "configured", patterns: []string{".github/**"}, want: []string{".github/**"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Config{ManagedPatterns: test.patterns}
+			if got := candidatePatterns(c, mappings); !slices.Equal(got, test.want) {
+				t.Errorf("candidatePatterns() = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if got := candidatePatterns(&Config{}, []fileMapping{{Dest: "README.md"}}); len(got) != 0 {
+		t.Errorf("candidatePatterns() of root files = %v, want none", got)
+	}
+}
+
+func TestUnmanagedCandidates(t *testing.T) {
+	repo_dir := t.TempDir()
+	for _, file_rel := range []string{
+		"README.md",
+		"LICENSE",
+		".github/workflows/main.yml",
+		".github/workflows/old.yml",
+		".github/workflows/nested/deep.yml",
+		"scripts/lint.sh",
+		"scripts/custom.sh",
+		".git/config",
+	} {
+		writeTestFile(t, filepath.Join(repo_dir, file_rel), "", 0644)
+	}
+	mappings := []fileMapping{
+		{Dest: "README.md"},
+		{Dest: ".github/workflows/main.yml"},
+		{Dest: "scripts/lint.sh"},
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{
+			name:     "derived",
+			patterns: candidatePatterns(&Config{}, mappings),
+			want:     []string{".github/workflows/old.yml", "scripts/custom.sh"},
+		},
+		{
+			name:     "recursive",
+			patterns: []string{".github/**"},
+			want:     []string{".github/workflows/nested/deep.yml", ".github/workflows/old.yml"},
+		},
+		{name: "root", patterns: []string{"*"}, want: []string{"LICENSE"}},
+		{name: "git dir", patterns: []string{".git/*"}, want: nil},
+		{name: "none", patterns: nil, want: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := unmanagedCandidates(repo_dir, test.patterns, mappings)
+			if err != nil {
+				t.Fatalf("unmanagedCandidates() failed: %v", err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("unmanagedCandidates(%v) = %v, want %v", test.patterns, got, test.want)
+			}
+		})
+	}
+}